@@ -0,0 +1,87 @@
+// Command lorenz runs the Wolfgang Lorenz test suite headless and writes a
+// pass/fail report. It exits with status 1 if any test failed.
+//
+//	lorenz -tests path/to/testsuite [-start ldab] [-o report.txt]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jejer/commando64/pkg/c64"
+	"github.com/jejer/commando64/pkg/c64/lorenz"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+func main() {
+	testDir := flag.String("tests", "", "directory with the test suite PRG files")
+	start := flag.String("start", "start", "first test to run")
+	romDir := flag.String("roms", "", "ROM directory, default $"+machine.ROMDirEnv+" or the user config directory")
+	modelName := flag.String("model", "PAL", "machine model: PAL, NTSC or NTSC-OLD")
+	timeout := flag.Uint64("timeout", lorenz.DefaultTimeout, "cycles a single test may run")
+	out := flag.String("o", "", "report file, default stdout")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	if *testDir == "" {
+		fmt.Fprintln(os.Stderr, "lorenz: -tests is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *romDir == "" {
+		dir, ok := machine.FindROMDir()
+		if !ok {
+			fmt.Fprintln(os.Stderr, "lorenz: no ROM directory, use -roms or $"+machine.ROMDirEnv)
+			os.Exit(2)
+		}
+		*romDir = dir
+	}
+
+	model, err := c64.ModelByName(*modelName)
+	if err != nil {
+		fail(err)
+	}
+	roms, err := machine.LoadROMSet(*romDir)
+	if err != nil {
+		fail(err)
+	}
+	m, err := machine.New(machine.WithLogger(*logger), machine.WithModel(model), machine.WithROMSet(roms))
+	if err != nil {
+		fail(err)
+	}
+	r, err := lorenz.NewRunner(m, os.DirFS(*testDir), *start)
+	if err != nil {
+		fail(err)
+	}
+	r.Timeout = *timeout
+	results, err := r.Run()
+	if err != nil {
+		fail(err)
+	}
+
+	var w io.WriteCloser = os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			fail(err)
+		}
+	}
+	if err := lorenz.WriteReport(w, results); err != nil {
+		fail(err)
+	}
+	if err := w.Close(); err != nil {
+		fail(err)
+	}
+	for _, res := range results {
+		if !res.Passed {
+			os.Exit(1)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -1,20 +1,49 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"text/template"
 
 	"log/slog"
 
 	"github.com/jejer/commando64/pkg/c64"
-	"github.com/jejer/commando64/pkg/c64/cia"
 	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/coverage"
 	"github.com/jejer/commando64/pkg/c64/cpu"
-	"github.com/jejer/commando64/pkg/c64/memory"
+	"github.com/jejer/commando64/pkg/c64/machine"
+	"github.com/jejer/commando64/pkg/c64/monitor"
 	"github.com/jejer/commando64/pkg/c64/peripheral"
-	"github.com/jejer/commando64/pkg/c64/vic"
+	"github.com/jejer/commando64/pkg/c64/profile"
+	"github.com/jejer/commando64/pkg/c64/trace"
+	"github.com/veandco/go-sdl2/sdl"
 )
 
+// stock ROMs, used when no ROM directory is configured
+//
+//go:embed test/roms/basic.901226-01.bin test/roms/kernal.901227-03.bin test/roms/characters.901225-01.bin
+var embeddedROMs embed.FS
+
 func main() {
+	modelName := flag.String("model", "PAL", "machine model: PAL, NTSC or NTSC-OLD")
+	romDir := flag.String("roms", "", "ROM directory, default $"+machine.ROMDirEnv+" or the user config directory")
+	var tf traceFlags
+	flag.StringVar(&tf.file, "trace", "", "write an instruction trace to this file")
+	flag.StringVar(&tf.format, "trace-format", "", "trace line template, default the VICE layout")
+	flag.StringVar(&tf.start, "trace-start", "", "start tracing at a PC or PC range, e.g. $c000-$c0ff")
+	flag.StringVar(&tf.stop, "trace-stop", "", "stop tracing at a PC or PC range")
+	flag.StringVar(&tf.cycles, "trace-cycles", "", "only trace the instructions in a cycle range")
+	flag.IntVar(&tf.history, "trace-history", 0, "instructions to dump on a CPU jam")
+	profileFile := flag.String("profile", "", "write a pprof profile of the 6502 code to this file on exit")
+	coverageFile := flag.String("coverage", "", "write the memory coverage map to this .json, .csv or .png file on exit")
+	monitorFile := flag.String("monitor", "", "run the monitor commands in this file before starting, e.g. a c000 inc $d020")
+	flag.Parse()
+
 	fmt.Println("Hello Commando C64")
 
 	// opts := &slog.HandlerOptions{
@@ -24,28 +53,203 @@ func main() {
 	// logger := slog.New(handler)
 	logger := slog.Default()
 
+	model, err := c64.ModelByName(*modelName)
+	if err != nil {
+		logger.Error("Can't select model", "err", err)
+		os.Exit(1)
+	}
+
 	peripheral := peripheral.NewPeripheralSDL(*logger)
 	peripheral.Init()
-	irqCh := make(chan bool)
-	clock := clock.NewClock()
-	cia1 := cia.NewCIA1(*logger, clock, irqCh, peripheral)
-	cia2 := cia.NewCIA2(*logger, clock, irqCh)
-	memory := memory.NewC64Memory(*logger, cia1, cia2, nil)
-	vic := vic.NewVICII(*logger, clock, memory, irqCh, peripheral)
-	memory.SetVIC(vic)
-	cpu := cpu.NewCPU(*logger, clock, memory, irqCh)
-
-	memory.Write(0x01, 0x07)
-	memory.LoadRom("test/roms/basic.901226-01.bin", c64.BasicRomAddr, false)
-	memory.LoadRom("test/roms/kernal.901227-03.bin", c64.KernalRomAddr, false)
-	memory.LoadRom("test/roms/characters.901225-01.bin", c64.CharsRomAddr, false)
-
-	cpu.Reset()
-	go cia1.Run()
-	go cia2.Run()
-	go cpu.Run()
-	go vic.Run()
-	// go clock.Run()
+
+	roms, err := loadROMs(*romDir)
+	if err != nil {
+		logger.Error("Can't load ROMs", "err", err)
+		os.Exit(1)
+	}
+	m, err := machine.New(
+		machine.WithLogger(*logger),
+		machine.WithModel(model),
+		machine.WithPeripheral(peripheral),
+		machine.WithROMSet(roms),
+	)
+	if err != nil {
+		logger.Error("Can't create machine", "err", err)
+		os.Exit(1)
+	}
+	if *monitorFile != "" {
+		if err := runMonitor(m, *monitorFile); err != nil {
+			logger.Error("Monitor failed", "err", err)
+			os.Exit(1)
+		}
+	}
+	var tracers cpu.Tracers
+	t, closeTrace, err := tf.open(m)
+	if err != nil {
+		logger.Error("Can't trace", "err", err)
+		os.Exit(1)
+	}
+	defer closeTrace()
+	if t != nil {
+		tracers = append(tracers, t)
+	}
+	if *profileFile != "" {
+		p := profile.New(m)
+		tracers = append(tracers, p)
+		defer writeProfile(p, *profileFile)
+	}
+	if *coverageFile != "" {
+		r := coverage.New(m)
+		tracers = append(tracers, r)
+		defer func() {
+			r.Close()
+			if err := r.WriteFile(*coverageFile); err != nil {
+				logger.Error("Can't write the coverage map", "err", err)
+			}
+		}()
+	}
+	if len(tracers) > 0 {
+		m.SetTracer(tracers)
+	}
+	m.EnableRewind(30)
+	peripheral.BindKey(sdl.SCANCODE_F9, func() {
+		if err := m.RewindSeconds(1); err != nil {
+			logger.Error("Rewind failed", "err", err)
+		}
+	})
+	peripheral.BindKey(sdl.SCANCODE_F10, func() {
+		if err := m.RewindFrames(1); err != nil {
+			logger.Error("Rewind failed", "err", err)
+		}
+	})
+	speed := 100
+	peripheral.BindKey(sdl.SCANCODE_F11, func() {
+		if m.Speed() == clock.Warp {
+			m.SetSpeed(speed)
+		} else {
+			m.SetSpeed(clock.Warp)
+		}
+	})
+	peripheral.BindKey(sdl.SCANCODE_PAGEUP, func() {
+		speed = min(speed+10, clock.MaxSpeed)
+		m.SetSpeed(speed)
+	})
+	peripheral.BindKey(sdl.SCANCODE_PAGEDOWN, func() {
+		speed = max(speed-10, clock.MinSpeed)
+		m.SetSpeed(speed)
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		err := m.Run(context.Background())
+		if err != nil {
+			// e.g. a jammed CPU, the window stays open until closed
+			logger.Error("Machine stopped", "err", err)
+		}
+		done <- err
+	}()
 
 	peripheral.EventLoop()
+	m.Stop()
+	<-done
+	peripheral.Close()
+}
+
+func loadROMs(dir string) (machine.ROMSet, error) {
+	if dir == "" {
+		dir, _ = machine.FindROMDir()
+	}
+	if dir != "" {
+		return machine.LoadROMSet(dir)
+	}
+	fsys, err := fs.Sub(embeddedROMs, "test/roms")
+	if err != nil {
+		return machine.ROMSet{}, err
+	}
+	return machine.LoadROMSetFS(fsys)
+}
+
+type traceFlags struct {
+	file, format        string
+	start, stop, cycles string
+	history             int
+}
+
+// open sets up a tracer if any trace flag is set, the returned func
+// flushes and closes the trace file.
+func (tf traceFlags) open(m *machine.Machine) (*trace.Tracer, func(), error) {
+	if tf.file == "" && tf.history == 0 {
+		return nil, func() {}, nil
+	}
+	var start, stop, filter trace.Condition
+	for _, c := range []struct {
+		flag string
+		cond *trace.Condition
+	}{{tf.start, &start}, {tf.stop, &stop}} {
+		if c.flag == "" {
+			continue
+		}
+		from, to, err := trace.ParseRange(c.flag)
+		if err != nil {
+			return nil, nil, err
+		}
+		*c.cond = trace.PCRange(uint16(from), uint16(to))
+	}
+	if tf.cycles != "" {
+		from, to, err := trace.ParseRange(tf.cycles)
+		if err != nil {
+			return nil, nil, err
+		}
+		filter = trace.CycleWindow(from, to+1)
+	}
+	var format *template.Template
+	if tf.format != "" {
+		var err error
+		if format, err = trace.Parse(tf.format); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var out io.Writer
+	var f *os.File
+	if tf.file != "" {
+		var err error
+		if f, err = os.Create(tf.file); err != nil {
+			return nil, nil, err
+		}
+		out = f
+	}
+	t := trace.New(m, out, tf.history)
+	t.Start, t.Stop, t.Filter, t.Format = start, stop, filter, format
+	t.Crash = os.Stderr
+	return t, func() {
+		if err := t.Flush(); err != nil {
+			slog.Error("Trace failed", "err", err)
+		}
+		if f != nil {
+			f.Close()
+		}
+	}, nil
+}
+
+func writeProfile(p *profile.Profiler, name string) {
+	f, err := os.Create(name)
+	if err == nil {
+		err = p.WritePprof(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Error("Can't write the profile", "err", err)
+	}
+}
+
+func runMonitor(m *machine.Machine, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return monitor.New(m, os.Stdout).Run(f)
 }
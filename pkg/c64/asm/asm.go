@@ -0,0 +1,392 @@
+// Package asm is a small two-pass 6502 assembler for test programs and
+// monitor patches. The syntax is the one the disasm package prints:
+//
+//	        .org $c000
+//	chrout = $ffd2
+//	start:  ldx #0
+//	loop:   lda text,x
+//	        beq done
+//	        jsr chrout
+//	        inx
+//	        bne loop
+//	done:   rts
+//	text:   .byte "HELLO", 13, 0
+//
+// Mnemonics, registers and directives are case insensitive, labels are not.
+// Numbers are decimal, $hex, %binary or 'c'haracters. Expressions know
+// + - * / & | ^, parentheses, unary -, < for the low and > for the high byte
+// and * for the address of the current line. An operand below $100 uses the
+// zero page form if there is one, unless it refers to a label defined further
+// down. The undocumented opcodes assemble by their disasm mnemonics.
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jejer/commando64/pkg/c64"
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+)
+
+// Error is an error on a line of the source, counting from 1.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("asm: line %d: %s", e.Line, e.Msg)
+}
+
+// Program is the result of an assembly.
+type Program struct {
+	Labels map[string]uint16
+	Start  uint16 // address of the first byte
+	End    uint16 // address after the last byte
+}
+
+type opKey struct {
+	name string
+	mode cpu.AddressingMode
+}
+
+// opcodes maps mnemonic and addressing mode to the opcode, the documented
+// one if there are several.
+var opcodes = map[opKey]uint8{}
+
+var (
+	mnemonics = map[string]bool{}
+	relative  = map[string]bool{} // the branches
+)
+
+func init() {
+	for op := 0; op < 0x100; op++ {
+		inst := cpu.Instructions[uint8(op)]
+		k := opKey{inst.Name(), inst.Mode()}
+		if prev, ok := opcodes[k]; !ok || (disasm.Illegal(prev) && !disasm.Illegal(uint8(op))) {
+			opcodes[k] = uint8(op)
+		}
+		mnemonics[inst.Name()] = true
+		if inst.Mode() == cpu.Relative {
+			relative[inst.Name()] = true
+		}
+	}
+}
+
+type statement struct {
+	line  int
+	label string
+	op    string // mnemonic or directive, upper case
+	args  string
+}
+
+type assembler struct {
+	mem    c64.BasicIO
+	labels map[string]uint16
+	pc     uint16
+	final  bool         // second pass, emit code
+	wide   map[int]bool // absolute instead of zero page, decided in the first pass
+	prog   Program
+	wrote  bool
+}
+
+// Assemble assembles src starting at org, or at the first .org, and writes
+// the code into mem.
+func Assemble(src string, org uint16, mem c64.BasicIO) (*Program, error) {
+	stmts, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	a := &assembler{mem: mem, labels: map[string]uint16{}, wide: map[int]bool{}}
+	for _, final := range []bool{false, true} {
+		a.final, a.pc = final, org
+		for i, s := range stmts {
+			if err := a.statement(i, s); err != nil {
+				return nil, &Error{s.line, err.Error()}
+			}
+		}
+	}
+	a.prog.Labels = a.labels
+	if !a.wrote {
+		a.prog.Start, a.prog.End = a.pc, a.pc
+	}
+	return &a.prog, nil
+}
+
+// parse splits the source into statements.
+func parse(src string) ([]statement, error) {
+	var stmts []statement
+	for n, line := range strings.Split(src, "\n") {
+		line = stripComment(line)
+		s := statement{line: n + 1}
+		if i := strings.IndexByte(line, '='); i > 0 && !strings.ContainsAny(line[:i], "'\"") {
+			s.label, s.op, s.args = strings.TrimSpace(line[:i]), "=", strings.TrimSpace(line[i+1:])
+			if s.label == "*" {
+				s.label, s.op = "", ".ORG"
+			} else if !isName(s.label) {
+				return nil, &Error{s.line, fmt.Sprintf("bad label %q", s.label)}
+			}
+			stmts = append(stmts, s)
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if i := strings.IndexByte(line, ':'); i > 0 && isName(line[:i]) {
+			s.label, line = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if line != "" {
+			op, args := line, ""
+			if j := strings.IndexAny(line, " \t"); j >= 0 {
+				op, args = line[:j], line[j+1:]
+			}
+			s.op, s.args = strings.ToUpper(op), strings.TrimSpace(args)
+		}
+		if s.label != "" || s.op != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts, nil
+}
+
+// stripComment removes a ; comment outside of quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isName(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (a *assembler) statement(i int, s statement) error {
+	if s.label != "" && s.op != "=" {
+		if err := a.define(s.label, a.pc); err != nil {
+			return err
+		}
+	}
+	switch s.op {
+	case "":
+		return nil
+	case "=":
+		v, known, err := a.eval(s.args)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return fmt.Errorf("%s: value must be defined before", s.label)
+		}
+		return a.define(s.label, uint16(v))
+	case ".ORG":
+		v, known, err := a.eval(s.args)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return fmt.Errorf(".org: value must be defined before")
+		}
+		a.pc = uint16(v)
+		return nil
+	case ".BYTE", ".WORD":
+		return a.data(s.op == ".WORD", s.args)
+	}
+	if strings.HasPrefix(s.op, ".") {
+		return fmt.Errorf("unknown directive %s", s.op)
+	}
+	return a.instruction(i, s.op, s.args)
+}
+
+func (a *assembler) define(label string, v uint16) error {
+	if old, ok := a.labels[label]; ok {
+		if !a.final {
+			return fmt.Errorf("%s redefined", label)
+		}
+		if old != v {
+			return fmt.Errorf("%s moved from $%04x to $%04x", label, old, v)
+		}
+	}
+	a.labels[label] = v
+	return nil
+}
+
+func (a *assembler) data(word bool, args string) error {
+	for _, arg := range splitArgs(args) {
+		if !word && len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+			for _, c := range []byte(arg[1 : len(arg)-1]) {
+				a.emit(c)
+			}
+			continue
+		}
+		v, err := a.value(arg)
+		if err != nil {
+			return err
+		}
+		switch {
+		case word:
+			a.emit(uint8(v), uint8(v>>8))
+		case v < -0x80 || v > 0xff:
+			return fmt.Errorf("byte out of range: %s", arg)
+		default:
+			a.emit(uint8(v))
+		}
+	}
+	return nil
+}
+
+// splitArgs splits at commas outside of quotes.
+func splitArgs(s string) []string {
+	var args []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func (a *assembler) instruction(i int, name, operand string) error {
+	has := func(mode cpu.AddressingMode) bool {
+		_, ok := opcodes[opKey{name, mode}]
+		return ok
+	}
+	if !mnemonics[name] {
+		return fmt.Errorf("unknown instruction %s", name)
+	}
+	emit := func(mode cpu.AddressingMode, operand ...uint8) error {
+		op, ok := opcodes[opKey{name, mode}]
+		if !ok {
+			return fmt.Errorf("%s does not support this addressing mode", name)
+		}
+		a.emit(append([]uint8{op}, operand...)...)
+		return nil
+	}
+
+	upper := strings.ToUpper(strings.ReplaceAll(operand, " ", ""))
+	switch {
+	case operand == "":
+		if has(cpu.Implied) {
+			return emit(cpu.Implied)
+		}
+		return emit(cpu.Accumulator)
+	case upper == "A" && has(cpu.Accumulator):
+		return emit(cpu.Accumulator)
+	case operand[0] == '#':
+		v, err := a.value(operand[1:])
+		if err != nil {
+			return err
+		}
+		if v < -0x80 || v > 0xff {
+			return fmt.Errorf("immediate value out of range: %s", operand)
+		}
+		return emit(cpu.Immidiate, uint8(v))
+	case relative[name]:
+		v, err := a.value(operand)
+		if err != nil {
+			return err
+		}
+		off := v - int(a.pc+2)
+		if a.final && (off < -128 || off > 127) {
+			return fmt.Errorf("branch out of range by %d bytes", max(-128-off, off-127))
+		}
+		return emit(cpu.Relative, uint8(off))
+	case strings.HasSuffix(upper, ",X)") && upper[0] == '(':
+		v, err := a.zeropage(operand[1:strings.LastIndexByte(operand, ',')])
+		if err != nil {
+			return err
+		}
+		return emit(cpu.IndexedIndirectX, v)
+	case strings.HasSuffix(upper, "),Y") && upper[0] == '(' && has(cpu.IndirectIndexedY):
+		v, err := a.zeropage(operand[1:strings.LastIndexByte(operand, ')')])
+		if err != nil {
+			return err
+		}
+		return emit(cpu.IndirectIndexedY, v)
+	case upper[0] == '(' && upper[len(upper)-1] == ')' && has(cpu.AbsoluteIndirect):
+		v, err := a.value(operand[1 : len(operand)-1])
+		if err != nil {
+			return err
+		}
+		return emit(cpu.AbsoluteIndirect, uint8(v), uint8(v>>8))
+	}
+
+	zp, abs, expr := cpu.Zeropage, cpu.Absolute, operand
+	if i := strings.LastIndexByte(operand, ','); i >= 0 {
+		switch strings.ToUpper(strings.TrimSpace(operand[i+1:])) {
+		case "X":
+			zp, abs, expr = cpu.IndexedZeropageX, cpu.IndexedAbsoluteX, operand[:i]
+		case "Y":
+			zp, abs, expr = cpu.IndexedZeropageY, cpu.IndexedAbsoluteY, operand[:i]
+		}
+	}
+	v, known, err := a.eval(expr)
+	if err != nil {
+		return err
+	}
+	if !a.final {
+		a.wide[i] = !known || v < 0 || v > 0xff || !has(zp)
+	} else if !known {
+		return fmt.Errorf("undefined label in %s", expr)
+	}
+	if a.wide[i] {
+		return emit(abs, uint8(v), uint8(v>>8))
+	}
+	return emit(zp, uint8(v))
+}
+
+// value evaluates an expression, in the first pass undefined labels are 0.
+func (a *assembler) value(expr string) (int, error) {
+	v, known, err := a.eval(expr)
+	if err == nil && !known && a.final {
+		err = fmt.Errorf("undefined label in %s", expr)
+	}
+	return v, err
+}
+
+func (a *assembler) zeropage(expr string) (uint8, error) {
+	v, err := a.value(expr)
+	if err == nil && (v < 0 || v > 0xff) {
+		err = fmt.Errorf("zero page address out of range: %s", expr)
+	}
+	return uint8(v), err
+}
+
+func (a *assembler) emit(b ...uint8) {
+	for _, v := range b {
+		if a.final {
+			if !a.wrote {
+				a.prog.Start, a.wrote = a.pc, true
+			}
+			a.mem.Write(a.pc, v)
+		}
+		a.pc++
+	}
+	if a.final {
+		a.prog.End = a.pc
+	}
+}
@@ -0,0 +1,108 @@
+package asm_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/asm"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+)
+
+func TestAssemble(t *testing.T) {
+	src := `
+		.org $c000
+chrout = $ffd2
+ptr = $fb
+start:	ldx #0          ; print the text
+loop:	lda text,x
+		beq done
+		jsr chrout
+		inx
+		bne loop
+done:	lda (ptr),y
+		sta later,x     ; forward, stays absolute
+		lda #<text
+		ldy #>text
+		jmp (vector)
+later:	.byte 0
+vector:	.word start, * + 2
+text:	.byte "HI;", 'a' - 'A', %1101
+`
+	var mem machinetest.RAM
+	prog, err := asm.Assemble(src, 0, &mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		0xa2, 0x00,
+		0xbd, 0x1e, 0xc0,
+		0xf0, 0x06,
+		0x20, 0xd2, 0xff,
+		0xe8,
+		0xd0, 0xf5,
+		0xb1, 0xfb,
+		0x9d, 0x19, 0xc0,
+		0xa9, 0x1e,
+		0xa0, 0xc0,
+		0x6c, 0x1a, 0xc0,
+		0x00,
+		0x00, 0xc0, 0x1e, 0xc0,
+		'H', 'I', ';', 0x20, 0x0d,
+	}
+	if got := mem[0xc000:prog.End]; !bytes.Equal(got, want) {
+		t.Errorf("got  % x\nwant % x", got, want)
+	}
+	if prog.Start != 0xc000 || prog.End != 0xc000+uint16(len(want)) {
+		t.Errorf("range $%04x-$%04x", prog.Start, prog.End)
+	}
+	if prog.Labels["loop"] != 0xc002 || prog.Labels["chrout"] != 0xffd2 {
+		t.Errorf("labels %v", prog.Labels)
+	}
+}
+
+// TestRoundTrip assembles the disassembly of every opcode.
+func TestRoundTrip(t *testing.T) {
+	for op := 0; op < 0x100; op++ {
+		code := []uint8{uint8(op), 0x12, 0x34}
+		read := func(addr uint16) uint8 { return code[addr-0x1000] }
+		line := disasm.Disassemble(read, 0x1000, nil)
+
+		var mem machinetest.RAM
+		if _, err := asm.Assemble(line.Text(), 0x1000, &mem); err != nil {
+			t.Errorf("%02x %s: %v", op, line.Text(), err)
+			continue
+		}
+		again := disasm.Disassemble(mem.Read, 0x1000, nil)
+		if again.Text() != line.Text() || !bytes.Equal(again.Bytes[1:], line.Bytes[1:]) {
+			t.Errorf("%02x %s: assembled to % x", op, line.Text(), again.Bytes)
+		}
+		if !disasm.Illegal(uint8(op)) && again.Bytes[0] != uint8(op) {
+			t.Errorf("%02x %s: assembled to opcode %02x", op, line.Text(), again.Bytes[0])
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		line int
+	}{
+		{"nop\nfoo", 2},
+		{"lda #$100", 1},
+		{"x: nop\nx: nop", 2},
+		{"jmp nowhere", 1},
+		{"stx $1234,x", 1},
+		{"l: nop\n.byte 0\n.org * + 200\nbne l", 4},
+		{".fill 3", 1},
+		{"lda (1+2", 1},
+	} {
+		var mem machinetest.RAM
+		_, err := asm.Assemble(tc.src, 0x1000, &mem)
+		var e *asm.Error
+		if !errors.As(err, &e) || e.Line != tc.line {
+			t.Errorf("%q: got %v, want an error on line %d", tc.src, err, tc.line)
+		}
+	}
+}
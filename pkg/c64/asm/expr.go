@@ -0,0 +1,162 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprParser evaluates an expression by recursive descent, lowest
+// precedence first: | ^ & + - * /.
+type exprParser struct {
+	a     *assembler
+	s     string
+	pos   int
+	known bool // false if an undefined label was used
+}
+
+// eval evaluates expr, known is false if it uses a label that is not
+// defined yet.
+func (a *assembler) eval(expr string) (v int, known bool, err error) {
+	p := &exprParser{a: a, s: strings.TrimSpace(expr), known: true}
+	if p.s == "" {
+		return 0, false, fmt.Errorf("missing expression")
+	}
+	v, err = p.binary(0)
+	if err == nil && p.skipSpace() < len(p.s) {
+		err = fmt.Errorf("unexpected %q in %s", p.s[p.pos:], expr)
+	}
+	return v, p.known, err
+}
+
+var precedence = []string{"|", "^", "&", "+-", "*/"}
+
+func (p *exprParser) skipSpace() int {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos
+}
+
+func (p *exprParser) binary(level int) (int, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	v, err := p.binary(level + 1)
+	for err == nil && p.skipSpace() < len(p.s) && strings.IndexByte(precedence[level], p.s[p.pos]) >= 0 {
+		op := p.s[p.pos]
+		p.pos++
+		var w int
+		if w, err = p.binary(level + 1); err != nil {
+			break
+		}
+		switch op {
+		case '|':
+			v |= w
+		case '^':
+			v ^= w
+		case '&':
+			v &= w
+		case '+':
+			v += w
+		case '-':
+			v -= w
+		case '*':
+			v *= w
+		case '/':
+			if w == 0 {
+				if p.known {
+					return 0, fmt.Errorf("division by zero")
+				}
+				w = 1
+			}
+			v /= w
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) unary() (int, error) {
+	if p.skipSpace() == len(p.s) {
+		return 0, fmt.Errorf("missing operand in %s", p.s)
+	}
+	switch p.s[p.pos] {
+	case '-':
+		p.pos++
+		v, err := p.unary()
+		return -v, err
+	case '<':
+		p.pos++
+		v, err := p.unary()
+		return v & 0xff, err
+	case '>':
+		p.pos++
+		v, err := p.unary()
+		return v >> 8 & 0xff, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (int, error) {
+	c := p.s[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		v, err := p.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if p.skipSpace() == len(p.s) || p.s[p.pos] != ')' {
+			return 0, fmt.Errorf("missing ) in %s", p.s)
+		}
+		p.pos++
+		return v, nil
+	case c == '*':
+		p.pos++
+		return int(p.a.pc), nil
+	case c == '\'':
+		if p.pos+2 >= len(p.s) || p.s[p.pos+2] != '\'' {
+			return 0, fmt.Errorf("bad character constant in %s", p.s)
+		}
+		p.pos += 3
+		return int(p.s[p.pos-2]), nil
+	case c == '$' || c == '%' || c >= '0' && c <= '9':
+		base := 10
+		switch c {
+		case '$':
+			base = 16
+			p.pos++
+		case '%':
+			base = 2
+			p.pos++
+		}
+		start := p.pos
+		for p.pos < len(p.s) && isAlnum(p.s[p.pos]) {
+			p.pos++
+		}
+		v, err := strconv.ParseUint(p.s[start:p.pos], base, 16)
+		if err != nil {
+			return 0, fmt.Errorf("bad number %s", p.s[start:p.pos])
+		}
+		return int(v), nil
+	case isAlnum(c):
+		start := p.pos
+		for p.pos < len(p.s) && isAlnum(p.s[p.pos]) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		if !isName(name) {
+			return 0, fmt.Errorf("bad label %s", name)
+		}
+		v, ok := p.a.labels[name]
+		if !ok {
+			p.known = false
+		}
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("unexpected %q in %s", p.s[p.pos:], p.s)
+}
+
+func isAlnum(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -2,17 +2,15 @@ package cia
 
 import (
 	"log/slog"
-	"time"
 
 	"github.com/jejer/commando64/pkg/c64"
-	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/irq"
 )
 
 type CIA1 struct {
 	logger       slog.Logger
 	peripheralIO c64.PeripheralIO
-	irqCh        chan<- bool
-	clock        *clock.Clock
+	irq          *irq.Controller
 
 	// https://www.c64-wiki.com/wiki/CIA
 	// $DC00 Data Port A, keyboard matrix columns
@@ -28,7 +26,7 @@ type CIA1 struct {
 	// $DC06 $DC07 TimerB
 	timerB uint16
 	// $DC08 ~ $DC0B Real Time Clock, 0.1s, 1s, 1m, 1h
-	rtc [4]uint8
+	tod tod
 	// $DC0C Serial shift register
 	sdr uint8
 	// $DC0D Interrupt Control and status
@@ -40,18 +38,73 @@ type CIA1 struct {
 	timerBIRQEnabled bool
 	timerBEnabled    bool
 	timerBCounter    uint16
+	todIRQEnabled    bool
 	// $DC0E Control Timer A
 	timerAControl uint8
 	// $DC0F Control Timer B
 	timerBControl uint8
 }
 
-func NewCIA1(logger slog.Logger, clock *clock.Clock, ch chan<- bool, io c64.PeripheralIO) *CIA1 {
-	cia1 := &CIA1{peripheralIO: io, irqCh: ch, clock: clock}
+func NewCIA1(logger slog.Logger, model c64.Model, irq *irq.Controller, io c64.PeripheralIO) *CIA1 {
+	cia1 := &CIA1{peripheralIO: io, irq: irq, tod: newTOD(model.ClockHz, model.PowerHz)}
 	cia1.logger = *logger.With("Component", "CIA1")
 	return cia1
 }
 
+func (cia1 *CIA1) State() State {
+	return State{
+		DataPortA:        cia1.dataPortA,
+		DataPortB:        cia1.dataPortB,
+		DataPortADir:     cia1.dataPortADir,
+		DataPortBDir:     cia1.dataPortBDir,
+		TimerA:           cia1.timerA,
+		TimerB:           cia1.timerB,
+		TOD:              cia1.tod.state(),
+		SDR:              cia1.sdr,
+		IRQControl:       cia1.irqControl,
+		IRQStatus:        cia1.irqStatus,
+		TimerAIRQEnabled: cia1.timerAIRQEnabled,
+		TimerAEnabled:    cia1.timerAEnabled,
+		TimerACounter:    cia1.timerACounter,
+		TimerBIRQEnabled: cia1.timerBIRQEnabled,
+		TimerBEnabled:    cia1.timerBEnabled,
+		TimerBCounter:    cia1.timerBCounter,
+		TODIRQEnabled:    cia1.todIRQEnabled,
+		TimerAControl:    cia1.timerAControl,
+		TimerBControl:    cia1.timerBControl,
+	}
+}
+
+func (cia1 *CIA1) SetState(s State) {
+	cia1.dataPortA = s.DataPortA
+	cia1.dataPortB = s.DataPortB
+	cia1.dataPortADir = s.DataPortADir
+	cia1.dataPortBDir = s.DataPortBDir
+	cia1.timerA = s.TimerA
+	cia1.timerB = s.TimerB
+	cia1.tod.setState(s.TOD)
+	cia1.sdr = s.SDR
+	cia1.irqControl = s.IRQControl
+	cia1.irqStatus = s.IRQStatus
+	cia1.timerAIRQEnabled = s.TimerAIRQEnabled
+	cia1.timerAEnabled = s.TimerAEnabled
+	cia1.timerACounter = s.TimerACounter
+	cia1.timerBIRQEnabled = s.TimerBIRQEnabled
+	cia1.timerBEnabled = s.TimerBEnabled
+	cia1.timerBCounter = s.TimerBCounter
+	cia1.todIRQEnabled = s.TODIRQEnabled
+	cia1.timerAControl = s.TimerAControl
+	cia1.timerBControl = s.TimerBControl
+}
+
+// Reset clears the registers as the RESET line does and releases the
+// interrupt line.
+func (cia1 *CIA1) Reset() {
+	cia1.SetState(resetState)
+	cia1.tod.reset()
+	cia1.updateIRQ()
+}
+
 func (cia1 *CIA1) Write(addr uint16, v uint8) {
 	switch addr {
 	case 0xdc00:
@@ -74,7 +127,8 @@ func (cia1 *CIA1) Write(addr uint16, v uint8) {
 	case 0xdc07:
 		cia1.timerB &= 0x00ff
 		cia1.timerB |= (uint16(v) << 8)
-	case 0xdc08, 0xdc09, 0xdc0a, 0xdc0b: // TODO: TOD registers
+	case 0xdc08, 0xdc09, 0xdc0a, 0xdc0b:
+		cia1.tod.write(addr-0xdc08, v, cia1.timerBControl&0x80 != 0)
 	case 0xdc0c: // serial shift register
 		cia1.sdr = v
 	case 0xdc0d:
@@ -95,6 +149,15 @@ func (cia1 *CIA1) Write(addr uint16, v uint8) {
 			cia1.logger.Debug("TimerB IRQ Disabled")
 			cia1.timerBIRQEnabled = false
 		}
+		if v&0x84 == 0x84 {
+			cia1.logger.Debug("TOD IRQ Enabled")
+			cia1.todIRQEnabled = true
+		}
+		if v&0x84 == 0x04 {
+			cia1.logger.Debug("TOD IRQ Disabled")
+			cia1.todIRQEnabled = false
+		}
+		cia1.updateIRQ()
 	case 0xdc0e:
 		cia1.timerAControl = v
 		if v&0x01 == 1 {
@@ -124,6 +187,21 @@ func (cia1 *CIA1) Write(addr uint16, v uint8) {
 	}
 }
 func (cia1 *CIA1) Read(addr uint16) uint8 {
+	switch addr {
+	case 0xdc08, 0xdc09, 0xdc0a, 0xdc0b:
+		return cia1.tod.read(addr - 0xdc08)
+	case 0xdc0d: // reading acknowledges the interrupts
+		v := cia1.irqStatus
+		cia1.irqStatus = 0
+		cia1.updateIRQ()
+		return v
+	}
+	return cia1.Peek(addr)
+}
+
+// Peek returns what Read would without side effects: it neither
+// acknowledges interrupts nor latches the TOD.
+func (cia1 *CIA1) Peek(addr uint16) uint8 {
 	switch addr {
 	case 0xdc00:
 	case 0xdc01:
@@ -155,7 +233,8 @@ func (cia1 *CIA1) Read(addr uint16) uint8 {
 		return uint8(cia1.timerBCounter & 0x00ff)
 	case 0xdc07:
 		return uint8((cia1.timerBCounter & 0xff00) >> 8)
-	case 0xdc08, 0xdc09, 0xdc0a, 0xdc0b: // TODO: TOD registers
+	case 0xdc08, 0xdc09, 0xdc0a, 0xdc0b:
+		return cia1.tod.peek(addr - 0xdc08)
 	case 0xdc0c:
 		return cia1.sdr
 	case 0xdc0d:
@@ -168,33 +247,49 @@ func (cia1 *CIA1) Read(addr uint16) uint8 {
 	return 0
 }
 
-func (cia1 *CIA1) Run() {
-	d := time.Duration(time.Second) / (50 * c64.ScreenLines * 63)
-	t := time.NewTicker(d)
-	for range t.C {
-		cia1.step()
+// Tick advances the timers by one cycle.
+func (cia1 *CIA1) Tick() {
+	if cia1.tod.tick(cia1.timerAControl&0x80 != 0) {
+		cia1.raise(0x04)
 	}
-}
-
-func (cia1 *CIA1) step() {
 	if cia1.timerAEnabled {
 		cia1.timerACounter--
 		if cia1.timerACounter == 0 {
-			if cia1.timerAIRQEnabled {
-				cia1.irqStatus |= 0x81
-				go func() { cia1.irqCh <- false }()
-			}
+			cia1.raise(0x01)
 			cia1.timerACounter = cia1.timerA
 		}
 	}
 	if cia1.timerBEnabled {
 		cia1.timerBCounter--
 		if cia1.timerBCounter == 0 {
-			if cia1.timerBIRQEnabled {
-				cia1.irqStatus |= 0x82
-				go func() { cia1.irqCh <- false }()
-			}
+			cia1.raise(0x02)
 			cia1.timerBCounter = cia1.timerB
 		}
 	}
 }
+
+// raise sets an interrupt flag, timer underflows and TOD alarms are flagged
+// whether or not their interrupt is enabled.
+func (cia1 *CIA1) raise(flag uint8) {
+	cia1.irqStatus |= flag
+	cia1.updateIRQ()
+}
+
+// updateIRQ sets the IR bit and asserts the IRQ line while an enabled
+// interrupt flag is set, the line is held until $DC0D is read.
+func (cia1 *CIA1) updateIRQ() {
+	var mask uint8
+	if cia1.timerAIRQEnabled {
+		mask |= 0x01
+	}
+	if cia1.timerBIRQEnabled {
+		mask |= 0x02
+	}
+	if cia1.todIRQEnabled {
+		mask |= 0x04
+	}
+	if cia1.irqStatus&mask != 0 {
+		cia1.irqStatus |= 0x80
+	}
+	cia1.irq.SetIRQ(irq.SourceCIA1, cia1.irqStatus&0x80 != 0)
+}
@@ -3,16 +3,14 @@ package cia
 import (
 	"fmt"
 	"log/slog"
-	"time"
 
 	"github.com/jejer/commando64/pkg/c64"
-	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/irq"
 )
 
 type CIA2 struct {
 	logger slog.Logger
-	irqCh  chan<- bool
-	clock  *clock.Clock
+	irq    *irq.Controller
 
 	// https://www.c64-wiki.com/wiki/CIA
 	// $DD00 Data Port A, keyboard matrix columns
@@ -28,7 +26,7 @@ type CIA2 struct {
 	// $DD06 $DD07 TimerB
 	timerB uint16
 	// $DD08 ~ $DD0B Real Time Clock, 0.1s, 1s, 1m, 1h
-	rtc [4]uint8
+	tod tod
 	// $DD0C Serial shift register
 	sdr uint8
 	// $DD0D Interrupt Control and status
@@ -40,18 +38,73 @@ type CIA2 struct {
 	timerBIRQEnabled bool
 	timerBEnabled    bool
 	timerBCounter    uint16
+	todIRQEnabled    bool
 	// $DD0E Control Timer A
 	timerAControl uint8
 	// $DD0F Control Timer B
 	timerBControl uint8
 }
 
-func NewCIA2(logger slog.Logger, clock *clock.Clock, irq chan<- bool) *CIA2 {
-	cia2 := &CIA2{irqCh: irq, clock: clock}
+func NewCIA2(logger slog.Logger, model c64.Model, irq *irq.Controller) *CIA2 {
+	cia2 := &CIA2{irq: irq, tod: newTOD(model.ClockHz, model.PowerHz)}
 	cia2.logger = *logger.With("Component", "CIA2")
 	return cia2
 }
 
+func (cia2 *CIA2) State() State {
+	return State{
+		DataPortA:        cia2.dataPortA,
+		DataPortB:        cia2.dataPortB,
+		DataPortADir:     cia2.dataPortADir,
+		DataPortBDir:     cia2.dataPortBDir,
+		TimerA:           cia2.timerA,
+		TimerB:           cia2.timerB,
+		TOD:              cia2.tod.state(),
+		SDR:              cia2.sdr,
+		IRQControl:       cia2.irqControl,
+		IRQStatus:        cia2.irqStatus,
+		TimerAIRQEnabled: cia2.timerAIRQEnabled,
+		TimerAEnabled:    cia2.timerAEnabled,
+		TimerACounter:    cia2.timerACounter,
+		TimerBIRQEnabled: cia2.timerBIRQEnabled,
+		TimerBEnabled:    cia2.timerBEnabled,
+		TimerBCounter:    cia2.timerBCounter,
+		TODIRQEnabled:    cia2.todIRQEnabled,
+		TimerAControl:    cia2.timerAControl,
+		TimerBControl:    cia2.timerBControl,
+	}
+}
+
+func (cia2 *CIA2) SetState(s State) {
+	cia2.dataPortA = s.DataPortA
+	cia2.dataPortB = s.DataPortB
+	cia2.dataPortADir = s.DataPortADir
+	cia2.dataPortBDir = s.DataPortBDir
+	cia2.timerA = s.TimerA
+	cia2.timerB = s.TimerB
+	cia2.tod.setState(s.TOD)
+	cia2.sdr = s.SDR
+	cia2.irqControl = s.IRQControl
+	cia2.irqStatus = s.IRQStatus
+	cia2.timerAIRQEnabled = s.TimerAIRQEnabled
+	cia2.timerAEnabled = s.TimerAEnabled
+	cia2.timerACounter = s.TimerACounter
+	cia2.timerBIRQEnabled = s.TimerBIRQEnabled
+	cia2.timerBEnabled = s.TimerBEnabled
+	cia2.timerBCounter = s.TimerBCounter
+	cia2.todIRQEnabled = s.TODIRQEnabled
+	cia2.timerAControl = s.TimerAControl
+	cia2.timerBControl = s.TimerBControl
+}
+
+// Reset clears the registers as the RESET line does and releases the
+// interrupt line.
+func (cia2 *CIA2) Reset() {
+	cia2.SetState(resetState)
+	cia2.tod.reset()
+	cia2.updateIRQ()
+}
+
 func (cia2 *CIA2) Write(addr uint16, v uint8) {
 	switch addr {
 	case 0xdd00:
@@ -75,7 +128,8 @@ func (cia2 *CIA2) Write(addr uint16, v uint8) {
 	case 0xdd07:
 		cia2.timerB &= 0x00ff
 		cia2.timerB |= (uint16(v) << 8)
-	case 0xdd08, 0xdd09, 0xdd0a, 0xdd0b: // TODO: TOD registers
+	case 0xdd08, 0xdd09, 0xdd0a, 0xdd0b:
+		cia2.tod.write(addr-0xdd08, v, cia2.timerBControl&0x80 != 0)
 	case 0xdd0c: // serial shift register
 		cia2.sdr = v
 	case 0xdd0d:
@@ -96,6 +150,15 @@ func (cia2 *CIA2) Write(addr uint16, v uint8) {
 			cia2.logger.Debug("TimerB IRQ Disabled")
 			cia2.timerBIRQEnabled = false
 		}
+		if v&0x84 == 0x84 {
+			cia2.logger.Debug("TOD IRQ Enabled")
+			cia2.todIRQEnabled = true
+		}
+		if v&0x84 == 0x04 {
+			cia2.logger.Debug("TOD IRQ Disabled")
+			cia2.todIRQEnabled = false
+		}
+		cia2.updateIRQ()
 	case 0xdd0e:
 		cia2.timerAControl = v
 		if v&0x01 == 1 {
@@ -125,6 +188,21 @@ func (cia2 *CIA2) Write(addr uint16, v uint8) {
 	}
 }
 func (cia2 *CIA2) Read(addr uint16) uint8 {
+	switch addr {
+	case 0xdd08, 0xdd09, 0xdd0a, 0xdd0b:
+		return cia2.tod.read(addr - 0xdd08)
+	case 0xdd0d: // reading acknowledges the interrupts
+		v := cia2.irqStatus
+		cia2.irqStatus = 0
+		cia2.updateIRQ()
+		return v
+	}
+	return cia2.Peek(addr)
+}
+
+// Peek returns what Read would without side effects: it neither
+// acknowledges interrupts nor latches the TOD.
+func (cia2 *CIA2) Peek(addr uint16) uint8 {
 	switch addr {
 	case 0xdd00:
 		return cia2.dataPortA
@@ -142,7 +220,8 @@ func (cia2 *CIA2) Read(addr uint16) uint8 {
 		return uint8(cia2.timerBCounter & 0x00ff)
 	case 0xdd07:
 		return uint8((cia2.timerBCounter & 0xff00) >> 8)
-	case 0xdd08, 0xdd09, 0xdd0a, 0xdd0b: // TODO: TOD registers
+	case 0xdd08, 0xdd09, 0xdd0a, 0xdd0b:
+		return cia2.tod.peek(addr - 0xdd08)
 	case 0xdd0c: // serial shift register
 		return cia2.sdr
 	case 0xdd0d:
@@ -155,33 +234,49 @@ func (cia2 *CIA2) Read(addr uint16) uint8 {
 	return 0
 }
 
-func (cia2 *CIA2) Run() {
-	d := time.Duration(time.Second) / (50 * c64.ScreenLines * 63)
-	t := time.NewTicker(d)
-	for range t.C {
-		cia2.step()
+// Tick advances the timers by one cycle.
+func (cia2 *CIA2) Tick() {
+	if cia2.tod.tick(cia2.timerAControl&0x80 != 0) {
+		cia2.raise(0x04)
 	}
-}
-
-func (cia2 *CIA2) step() {
 	if cia2.timerAEnabled {
 		cia2.timerACounter--
 		if cia2.timerACounter == 0 {
-			if cia2.timerAIRQEnabled {
-				cia2.irqStatus |= 0x81
-				go func() { cia2.irqCh <- true }()
-			}
+			cia2.raise(0x01)
 			cia2.timerACounter = cia2.timerA
 		}
 	}
 	if cia2.timerBEnabled {
 		cia2.timerBCounter--
 		if cia2.timerBCounter == 0 {
-			if cia2.timerBIRQEnabled {
-				cia2.irqStatus |= 0x82
-				go func() { cia2.irqCh <- true }()
-			}
+			cia2.raise(0x02)
 			cia2.timerBCounter = cia2.timerB
 		}
 	}
 }
+
+// raise sets an interrupt flag, timer underflows and TOD alarms are flagged
+// whether or not their interrupt is enabled.
+func (cia2 *CIA2) raise(flag uint8) {
+	cia2.irqStatus |= flag
+	cia2.updateIRQ()
+}
+
+// updateIRQ sets the IR bit and asserts the NMI line while an enabled
+// interrupt flag is set, the line is held until $DD0D is read.
+func (cia2 *CIA2) updateIRQ() {
+	var mask uint8
+	if cia2.timerAIRQEnabled {
+		mask |= 0x01
+	}
+	if cia2.timerBIRQEnabled {
+		mask |= 0x02
+	}
+	if cia2.todIRQEnabled {
+		mask |= 0x04
+	}
+	if cia2.irqStatus&mask != 0 {
+		cia2.irqStatus |= 0x80
+	}
+	cia2.irq.SetNMI(irq.SourceCIA2, cia2.irqStatus&0x80 != 0)
+}
@@ -0,0 +1,33 @@
+package cia
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64"
+	"github.com/jejer/commando64/pkg/c64/irq"
+)
+
+func TestPeek(t *testing.T) {
+	ctrl := irq.NewController()
+	cia := NewCIA2(*slog.Default(), c64.ModelPAL, ctrl)
+	cia.Write(0xdd04, 0x02) // timer A 2 cycles
+	cia.Write(0xdd05, 0x00)
+	cia.Write(0xdd0d, 0x81)
+	cia.Write(0xdd0e, 0x11)
+	cia.Tick()
+	cia.Tick()
+	if !ctrl.TakeNMI() {
+		t.Fatal("no timer interrupt")
+	}
+
+	if v := cia.Peek(0xdd0d); v != 0x81 {
+		t.Errorf("peek ICR = %02x, want 81", v)
+	}
+	if cia.Peek(0xdd0b); cia.Peek(0xdd0d) != 0x81 || cia.tod.latched {
+		t.Error("peek has side effects")
+	}
+	if v := cia.Read(0xdd0d); v != 0x81 || cia.Peek(0xdd0d) != 0 {
+		t.Errorf("read ICR = %02x, then %02x", v, cia.Peek(0xdd0d))
+	}
+}
@@ -0,0 +1,39 @@
+package cia
+
+// State is the state of a CIA captured in machine snapshots.
+type State struct {
+	DataPortA        uint8
+	DataPortB        uint8
+	DataPortADir     uint8
+	DataPortBDir     uint8
+	TimerA           uint16
+	TimerB           uint16
+	TOD              TODState
+	SDR              uint8
+	IRQControl       uint8
+	IRQStatus        uint8
+	TimerAIRQEnabled bool
+	TimerAEnabled    bool
+	TimerACounter    uint16
+	TimerBIRQEnabled bool
+	TimerBEnabled    bool
+	TimerBCounter    uint16
+	TODIRQEnabled    bool
+	TimerAControl    uint8
+	TimerBControl    uint8
+}
+
+// resetState is the state after a reset: ports as inputs, timers stopped
+// with the latches all ones, no interrupts.
+var resetState = State{TimerA: 0xffff, TimerB: 0xffff, TimerACounter: 0xffff, TimerBCounter: 0xffff}
+
+// TODState is the state of a time of day clock.
+type TODState struct {
+	Cycle   int32
+	Ticks   uint8
+	Time    [4]uint8
+	Alarm   [4]uint8
+	Latch   [4]uint8
+	Latched bool
+	Stopped bool
+}
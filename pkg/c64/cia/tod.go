@@ -0,0 +1,141 @@
+package cia
+
+// tod is the time of day clock of a CIA. It counts tenths of seconds,
+// seconds, minutes and hours in BCD and is driven by the mains frequency,
+// CRA bit 7 tells it whether that is 50 or 60 Hz.
+// http://unusedino.de/ec64/technical/aay/c64/cia1.htm
+type tod struct {
+	cyclesPerTick int // CPU cycles per mains tick
+	cycle         int
+	ticks         int      // mains ticks into the current tenth
+	time          [4]uint8 // tenths, seconds, minutes, hours (bit 7 PM)
+	alarm         [4]uint8
+	latch         [4]uint8
+	latched       bool // reading hours freezes the output until tenths are read
+	stopped       bool // writing hours stops the clock until tenths are written
+}
+
+func newTOD(clockHz, powerHz int) tod {
+	return tod{cyclesPerTick: clockHz / powerHz, time: [4]uint8{0, 0, 0, 1}}
+}
+
+func (t *tod) state() TODState {
+	return TODState{
+		Cycle:   int32(t.cycle),
+		Ticks:   uint8(t.ticks),
+		Time:    t.time,
+		Alarm:   t.alarm,
+		Latch:   t.latch,
+		Latched: t.latched,
+		Stopped: t.stopped,
+	}
+}
+
+func (t *tod) setState(s TODState) {
+	t.cycle = int(s.Cycle)
+	t.ticks = int(s.Ticks)
+	t.time = s.Time
+	t.alarm = s.Alarm
+	t.latch = s.Latch
+	t.latched = s.Latched
+	t.stopped = s.Stopped
+}
+
+// reset sets the clock to 1:00:00.0 AM and clears the alarm.
+func (t *tod) reset() {
+	*t = tod{cyclesPerTick: t.cyclesPerTick, time: [4]uint8{0, 0, 0, 1}}
+}
+
+// tick advances the clock by one CPU cycle and reports an alarm match.
+func (t *tod) tick(is50Hz bool) bool {
+	t.cycle++
+	if t.cycle < t.cyclesPerTick {
+		return false
+	}
+	t.cycle = 0
+	if t.stopped {
+		return false
+	}
+	t.ticks++
+	ticksPerTenth := 6
+	if is50Hz {
+		ticksPerTenth = 5
+	}
+	if t.ticks < ticksPerTenth {
+		return false
+	}
+	t.ticks = 0
+	t.advance()
+	return t.time == t.alarm
+}
+
+func (t *tod) advance() {
+	if t.time[0] = (t.time[0] + 1) & 0x0f; t.time[0] < 0x0a {
+		return
+	}
+	t.time[0] = 0
+	if t.time[1] = bcdInc(t.time[1]); t.time[1] < 0x60 {
+		return
+	}
+	t.time[1] = 0
+	if t.time[2] = bcdInc(t.time[2]); t.time[2] < 0x60 {
+		return
+	}
+	t.time[2] = 0
+	pm := t.time[3] & 0x80
+	switch hours := t.time[3] & 0x1f; hours {
+	case 0x11:
+		t.time[3] = 0x12 | (pm ^ 0x80)
+	case 0x12:
+		t.time[3] = 0x01 | pm
+	default:
+		t.time[3] = bcdInc(hours) | pm
+	}
+}
+
+// read returns TOD register reg, 0 is tenths ... 3 is hours.
+func (t *tod) read(reg uint16) uint8 {
+	if reg == 3 && !t.latched {
+		t.latch = t.time
+		t.latched = true
+	}
+	v := t.peek(reg)
+	if reg == 0 {
+		t.latched = false
+	}
+	return v
+}
+
+// peek returns TOD register reg without latching.
+func (t *tod) peek(reg uint16) uint8 {
+	if t.latched {
+		return t.latch[reg]
+	}
+	return t.time[reg]
+}
+
+// write sets TOD register reg, or the alarm when CRB bit 7 is set.
+func (t *tod) write(reg uint16, v uint8, alarm bool) {
+	mask := [4]uint8{0x0f, 0x7f, 0x7f, 0x9f}
+	v &= mask[reg]
+	if alarm {
+		t.alarm[reg] = v
+		return
+	}
+	t.time[reg] = v
+	switch reg {
+	case 3:
+		t.stopped = true
+	case 0:
+		t.stopped = false
+		t.cycle, t.ticks = 0, 0
+	}
+}
+
+func bcdInc(v uint8) uint8 {
+	v++
+	if v&0x0f == 0x0a {
+		v += 0x06
+	}
+	return v
+}
@@ -0,0 +1,49 @@
+package cia
+
+import (
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64"
+)
+
+func TestTODCounts(t *testing.T) {
+	for _, model := range c64.Models {
+		tod := newTOD(model.ClockHz, model.PowerHz)
+		tod.write(3, 0x91, false) // 11 PM
+		tod.write(2, 0x59, false)
+		tod.write(1, 0x59, false)
+		tod.write(0, 0x09, false)
+
+		// one tenth of a second at the mains frequency of the model
+		is50Hz := model.PowerHz == 50
+		for i := 0; i < model.ClockHz/10; i++ {
+			tod.tick(is50Hz)
+		}
+		want := [4]uint8{0, 0, 0, 0x12} // 12 AM
+		if tod.time != want {
+			t.Errorf("%s: time = %x, want %x", model.Name, tod.time, want)
+		}
+	}
+}
+
+func TestTODLatchAndAlarm(t *testing.T) {
+	tod := newTOD(c64.PALClockHz, 50)
+	tod.write(3, 0x01, true) // alarm at 1:00:00.9 AM
+	tod.write(0, 0x09, true)
+	hours := tod.read(3)
+	tod.time[0] = 5
+	if tenths := tod.read(0); tenths != 0 || hours != 1 {
+		t.Errorf("latched read = %x:%x, want 1:0", hours, tenths)
+	}
+	if tenths := tod.read(0); tenths != 5 {
+		t.Errorf("read after unlatch = %x, want 5", tenths)
+	}
+
+	alarm := false
+	for i := 0; i < c64.PALClockHz/2 && !alarm; i++ {
+		alarm = tod.tick(true)
+	}
+	if !alarm || tod.time[0] != 9 {
+		t.Errorf("alarm = %v at tenths %x, want true at 9", alarm, tod.time[0])
+	}
+}
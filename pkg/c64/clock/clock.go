@@ -1,35 +1,81 @@
 package clock
 
-import "time"
+// Chip is a component driven by the master clock.
+// Tick advances it by exactly one CPU cycle.
+type Chip interface {
+	Tick()
+}
+
+// BusMaster is the chip owning the bus, other chips halt it through its
+// RDY input to take the bus over.
+type BusMaster interface {
+	Chip
+	SetRDY(ready bool)
+}
 
+// Clock is the master scheduler. Every chip is advanced from one loop in a
+// fixed order, so the relative timing of the chips never depends on the Go
+// scheduler and two runs with the same input give the same result.
 type Clock struct {
-	pause bool
-	VIC   chan bool
-	CPU   chan int
-	CIA1  chan bool
-	CIA2  chan bool
+	cycles uint64
+	chips  []Chip
+	cpu    BusMaster
+}
+
+// State is the scheduler state captured in machine snapshots.
+type State struct {
+	Cycles uint64
 }
 
 func NewClock() *Clock {
-	c := &Clock{}
-	c.VIC = make(chan bool)
-	c.CPU = make(chan int)
-	c.CIA1 = make(chan bool)
-	c.CIA2 = make(chan bool)
-	return c
-}
-
-func (c *Clock) Pause(pause bool) {
-	c.pause = pause
-}
-
-func (c *Clock) Run() {
-	for {
-		<-time.After(time.Duration(time.Microsecond)) // PAL cpu clock is 0.985MHz
-		if !c.pause {
-			c.CIA1 <- true
-			c.CIA2 <- true
-			// c.VIC <- true
-		}
+	return &Clock{}
+}
+
+// Attach adds chips to the scheduler, they are ticked in the order attached.
+func (c *Clock) Attach(chips ...Chip) {
+	c.chips = append(c.chips, chips...)
+}
+
+// AttachCPU sets the bus master, it is ticked after all other chips.
+func (c *Clock) AttachCPU(cpu BusMaster) {
+	c.cpu = cpu
+}
+
+// SetRDY drives the RDY line of the bus master, e.g. the VIC pulls it low
+// to fetch character pointers on a bad line.
+func (c *Clock) SetRDY(ready bool) {
+	if c.cpu != nil {
+		c.cpu.SetRDY(ready)
+	}
+}
+
+// Cycles returns the number of cycles elapsed since the clock was created.
+func (c *Clock) Cycles() uint64 {
+	return c.cycles
+}
+
+func (c *Clock) State() State {
+	return State{Cycles: c.cycles}
+}
+
+func (c *Clock) SetState(s State) {
+	c.cycles = s.Cycles
+}
+
+// Step advances the whole machine by one cycle.
+func (c *Clock) Step() {
+	for _, chip := range c.chips {
+		chip.Tick()
+	}
+	if c.cpu != nil {
+		c.cpu.Tick()
+	}
+	c.cycles++
+}
+
+// RunCycles advances the whole machine by n cycles.
+func (c *Clock) RunCycles(n int) {
+	for i := 0; i < n; i++ {
+		c.Step()
 	}
 }
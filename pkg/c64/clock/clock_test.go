@@ -0,0 +1,61 @@
+package clock
+
+import "testing"
+
+type recorder struct {
+	name   string
+	log    *[]string
+	halted bool
+}
+
+func (r *recorder) Tick() {
+	if !r.halted {
+		*r.log = append(*r.log, r.name)
+	}
+}
+
+func (r *recorder) SetRDY(ready bool) {
+	r.halted = !ready
+}
+
+func TestClockOrderAndRDY(t *testing.T) {
+	var log []string
+	c := NewClock()
+	c.Attach(&recorder{name: "vic", log: &log}, &recorder{name: "cia", log: &log})
+	c.AttachCPU(&recorder{name: "cpu", log: &log})
+
+	c.Step()
+	c.SetRDY(false)
+	c.RunCycles(2)
+	c.SetRDY(true)
+	c.Step()
+
+	want := []string{"vic", "cia", "cpu", "vic", "cia", "vic", "cia", "vic", "cia", "cpu"}
+	if len(log) != len(want) {
+		t.Fatalf("got %v, want %v", log, want)
+	}
+	for i := range want {
+		if log[i] != want[i] {
+			t.Fatalf("got %v, want %v", log, want)
+		}
+	}
+	if c.Cycles() != 4 {
+		t.Errorf("cycles = %d, want 4", c.Cycles())
+	}
+}
+
+func TestThrottleSpeed(t *testing.T) {
+	th := NewThrottle(1000)
+	for _, c := range []struct{ set, want int }{
+		{1, MinSpeed}, {5000, MaxSpeed}, {250, 250}, {Warp, Warp},
+	} {
+		th.SetSpeed(c.set)
+		if got := th.Speed(); got != c.want {
+			t.Errorf("SetSpeed(%d): speed = %d, want %d", c.set, got, c.want)
+		}
+	}
+
+	// in warp a whole emulated hour must not block
+	th.Sync(0)
+	th.Sync(1000 * 3600)
+}
@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// don't try to catch up when the host falls further behind than this
+	maxLag = 100 * time.Millisecond
+
+	// speed limits in percent of real time, Warp runs unthrottled
+	Warp     = 0
+	MinSpeed = 10
+	MaxSpeed = 1000
+)
+
+// Throttle keeps the emulated cycles in step with the wall clock.
+// It is a separate layer on top of the scheduler, which never looks at time.
+type Throttle struct {
+	mu         sync.Mutex
+	hz         float64
+	speed      int
+	start      time.Time
+	startCycle uint64
+
+	measureStart time.Time
+	measureCycle uint64
+}
+
+func NewThrottle(hz int) *Throttle {
+	return &Throttle{hz: float64(hz), speed: 100}
+}
+
+// SetSpeed sets the speed in percent of real time, clamped to
+// MinSpeed..MaxSpeed, or Warp to run as fast as possible.
+func (t *Throttle) SetSpeed(percent int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case percent == Warp:
+	case percent < MinSpeed:
+		percent = MinSpeed
+	case percent > MaxSpeed:
+		percent = MaxSpeed
+	}
+	t.speed = percent
+	t.start = time.Time{} // resync on the next Sync
+}
+
+func (t *Throttle) Speed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.speed
+}
+
+// Reset starts measuring wall time from now at the given cycle count.
+func (t *Throttle) Reset(cycles uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset(cycles)
+}
+
+func (t *Throttle) reset(cycles uint64) {
+	t.start = time.Now()
+	t.startCycle = cycles
+}
+
+// Sync blocks until the wall clock has caught up with the given cycle count.
+func (t *Throttle) Sync(cycles uint64) {
+	t.mu.Lock()
+	if t.speed == Warp {
+		t.mu.Unlock()
+		return
+	}
+	if t.start.IsZero() {
+		t.reset(cycles)
+		t.mu.Unlock()
+		return
+	}
+	hz := t.hz * float64(t.speed) / 100
+	elapsed := time.Duration(float64(cycles-t.startCycle) / hz * float64(time.Second))
+	d := time.Until(t.start.Add(elapsed))
+	if d < -maxLag {
+		t.reset(cycles)
+	}
+	t.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Measure returns the effective speed in percent of real time since the
+// previous call, and starts a new measurement.
+func (t *Throttle) Measure(cycles uint64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	var percent float64
+	if !t.measureStart.IsZero() {
+		seconds := now.Sub(t.measureStart).Seconds()
+		percent = float64(cycles-t.measureCycle) / t.hz / seconds * 100
+	}
+	t.measureStart = now
+	t.measureCycle = cycles
+	return percent
+}
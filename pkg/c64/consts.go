@@ -1,7 +1,7 @@
 package c64
 
 const (
-	// screen constants
+	// screen constants, timing is PAL, see Model for the other models
 	// https://dustlayer.com/vic-ii/2013/4/25/vic-ii-for-beginners-beyond-the-screen-rasters-cycle
 	ScreenLines            = 312
 	ScreenWidth            = 504
@@ -18,8 +18,32 @@ const (
 	LineCycles             = 63
 	BadLineCycles          = 23
 
+	// clock
+	PALClockHz  = 985248
+	NTSCClockHz = 1022727
+
 	// roms
 	BasicRomAddr  uint16 = 0xa000
 	KernalRomAddr uint16 = 0xe000
 	CharsRomAddr  uint16 = 0xd000
 )
+
+// Palette holds the 16 C64 colors as ARGB.
+var Palette = [16]uint32{
+	0xff000000,
+	0xffffffff,
+	0xffab3126,
+	0xff66daff,
+	0xffbb3fb8,
+	0xff55ce58,
+	0xff1d0e97,
+	0xffeaf57c,
+	0xffb97418,
+	0xff785300,
+	0xffdd9387,
+	0xff5b5b5b,
+	0xff8b8b8b,
+	0xffb0f4ac,
+	0xffaa9def,
+	0xffb8b8b8,
+}
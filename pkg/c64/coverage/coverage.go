@@ -0,0 +1,110 @@
+// Package coverage records how the CPU uses each of the 64K addresses: run
+// as an opcode, run as an operand, read as data or written. The map tells
+// code from data and shows dead code, it is written as JSON, CSV or a PNG
+// heatmap.
+//
+//	r := coverage.New(m)
+//	m.SetTracer(r)
+//	... run the machine ...
+//	r.Close()
+//	r.WriteFile("coverage.png")
+//
+// The opcode and operand bytes come from the instructions the CPU starts,
+// reads and writes from the memory bus. The fetches of the instruction in
+// progress do not count as data reads, neither do the dummy reads whose
+// value the CPU discards.
+package coverage
+
+import (
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+// Access is a set of the ways an address was used.
+type Access uint8
+
+const (
+	Opcode Access = 1 << iota
+	Operand
+	Read
+	Write
+)
+
+var accessNames = []string{"opcode", "operand", "read", "write"}
+
+// Names returns the names of the accesses in a.
+func (a Access) Names() []string {
+	var names []string
+	for i, name := range accessNames {
+		if a&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Map is the coverage of the address space. Counts holds the number of
+// accesses of each kind, in the order of the Access bits.
+type Map struct {
+	Access [0x10000]Access
+	Counts [4][0x10000]uint32
+}
+
+func (m *Map) add(addr uint16, a Access, kind int) {
+	m.Access[addr] |= a
+	if m.Counts[kind][addr] != ^uint32(0) {
+		m.Counts[kind][addr]++
+	}
+}
+
+// Recorder is a cpu.Tracer filling a Map.
+type Recorder struct {
+	Map
+
+	m         *machine.Machine
+	hook      int
+	from, end uint16 // the bytes of the instruction in progress
+}
+
+// New starts recording the memory accesses of m, attach the recorder with
+// m.SetTracer for the executed bytes.
+func New(m *machine.Machine) *Recorder {
+	r := &Recorder{m: m}
+	r.hook = m.AddAccessHook(r.access)
+	return r
+}
+
+// Close stops recording the memory accesses.
+func (r *Recorder) Close() {
+	r.m.RemoveAccessHook(r.hook)
+}
+
+// Instruction implements cpu.Tracer.
+func (r *Recorder) Instruction(c *cpu.CPU) {
+	pc := c.State().PC
+	n := disasm.Length(r.m.Memory().Peek(pc))
+	r.add(pc, Opcode, 0)
+	for i := 1; i < n; i++ {
+		r.add(pc+uint16(i), Operand, 1)
+	}
+	r.from, r.end = pc, pc+uint16(n)
+}
+
+// Interrupt implements cpu.Tracer.
+func (r *Recorder) Interrupt(c *cpu.CPU, nmi bool) {
+	r.from, r.end = 0, 0
+}
+
+// Halt implements cpu.Tracer.
+func (r *Recorder) Halt(c *cpu.CPU, err error) {}
+
+func (r *Recorder) access(addr uint16, v uint8, write bool) {
+	switch {
+	case write:
+		r.add(addr, Write, 3)
+	case r.m.CPU().DummyRead():
+	case addr-r.from >= r.end-r.from: // not a fetch of the instruction
+		r.add(addr, Read, 2)
+	}
+}
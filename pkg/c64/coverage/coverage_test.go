@@ -0,0 +1,152 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+)
+
+// record runs src from $c000 with interrupts disabled for the given number
+// of instructions.
+func record(t *testing.T, src string, n int) *Recorder {
+	m, _ := machinetest.Load(t, src)
+	r := New(m)
+	m.SetTracer(r)
+	for i := 0; i < n; i++ {
+		m.StepInstruction()
+	}
+	r.Close()
+	return r
+}
+
+const program = `
+	lda data    ; c000
+	sta $c100   ; c003
+loop:	jmp loop    ; c006
+	rts         ; c009, never run
+data:	.byte 5     ; c00a`
+
+func TestRecorder(t *testing.T) {
+	r := record(t, program, 5)
+	for _, tc := range []struct {
+		addr uint16
+		want Access
+	}{
+		{0xc000, Opcode}, {0xc001, Operand}, {0xc002, Operand},
+		{0xc003, Opcode}, {0xc006, Opcode}, {0xc008, Operand},
+		{0xc009, 0}, {0xc00a, Read}, {0xc100, Write},
+	} {
+		if got := r.Access[tc.addr]; got != tc.want {
+			t.Errorf("$%04x: %v, want %v", tc.addr, got.Names(), tc.want.Names())
+		}
+	}
+	if got := r.Counts[0][0xc006]; got != 3 {
+		t.Errorf("jmp run %d times, want 3", got)
+	}
+}
+
+// TestDummyReads checks the reads the CPU discards do not count: INX reads
+// the next opcode, a taken branch the next instruction and RTS the byte
+// after it and the last byte of JSR.
+func TestDummyReads(t *testing.T) {
+	r := record(t, `
+	jsr sub     ; c000
+	ldx #1      ; c003
+loop:	inx         ; c005
+	bne loop    ; c006
+	brk         ; c008, never run
+sub:	rts         ; c009
+	.byte 0     ; c00a`, 8)
+	for _, tc := range []struct {
+		addr uint16
+		want Access
+	}{
+		{0xc002, Operand}, {0xc006, Opcode}, {0xc008, 0}, {0xc00a, 0},
+	} {
+		if got := r.Access[tc.addr]; got != tc.want {
+			t.Errorf("$%04x: %v, want %v", tc.addr, got.Names(), tc.want.Names())
+		}
+	}
+	var stack uint32
+	for addr := 0x0100; addr < 0x0200; addr++ {
+		stack += r.Counts[2][addr]
+	}
+	if stack != 2 {
+		t.Errorf("%d stack reads, want the 2 pulls of RTS", stack)
+	}
+}
+
+// TestVICFetches runs a few frames with the display on, the VIC's color RAM
+// fetches are not CPU reads.
+func TestVICFetches(t *testing.T) {
+	r := record(t, `
+	lda #$1b
+	sta $d011   ; display on
+loop:	jmp loop`, 20000)
+	for addr := 0xd800; addr < 0xdc00; addr++ {
+		if a := r.Access[addr]; a != 0 {
+			t.Fatalf("$%04x: %v", addr, a.Names())
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	r := record(t, program, 3)
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var ranges []Range
+	if err := json.Unmarshal(buf.Bytes(), &ranges); err != nil {
+		t.Fatal(err)
+	}
+	want := []Range{
+		{0xc000, 0xc000, []string{"opcode"}},
+		{0xc001, 0xc002, []string{"operand"}},
+		{0xc003, 0xc003, []string{"opcode"}},
+		{0xc004, 0xc005, []string{"operand"}},
+		{0xc006, 0xc006, []string{"opcode"}},
+		{0xc007, 0xc008, []string{"operand"}},
+		{0xc00a, 0xc00a, []string{"read"}},
+		{0xc100, 0xc100, []string{"write"}},
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("ranges %+v, want %+v", ranges, want)
+	}
+
+	buf.Reset()
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 12 || lines[0] != "address,opcode,operand,read,write" || lines[1] != "c000,1,0,0,0" || lines[11] != "c100,0,0,0,1" {
+		t.Errorf("CSV:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := r.WritePNG(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 512 || b.Dy() != 512 {
+		t.Fatalf("image bounds %v", b)
+	}
+	for _, tc := range []struct {
+		addr    int
+		r, g, b bool
+	}{{0xc000, true, false, false}, {0xc00a, false, true, false}, {0xc100, false, false, true}, {0x0000, false, false, false}} {
+		cr, cg, cb, _ := img.At(tc.addr&0xff*2, tc.addr>>8*2).RGBA()
+		if (cr != 0) != tc.r || (cg != 0) != tc.g || (cb != 0) != tc.b {
+			t.Errorf("$%04x: color %04x %04x %04x", tc.addr, cr, cg, cb)
+		}
+	}
+}
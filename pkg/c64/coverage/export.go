@@ -0,0 +1,134 @@
+package coverage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Range is a run of addresses used the same way.
+type Range struct {
+	From   uint16   `json:"from"`
+	To     uint16   `json:"to"` // inclusive
+	Access []string `json:"access"`
+}
+
+// Ranges returns the runs of used addresses, the unused ones are left out.
+func (m *Map) Ranges() []Range {
+	var ranges []Range
+	for addr := 0; addr < 0x10000; {
+		a := m.Access[addr]
+		end := addr + 1
+		for end < 0x10000 && m.Access[end] == a {
+			end++
+		}
+		if a != 0 {
+			ranges = append(ranges, Range{uint16(addr), uint16(end - 1), a.Names()})
+		}
+		addr = end
+	}
+	return ranges
+}
+
+// WriteJSON writes the ranges as a JSON array.
+func (m *Map) WriteJSON(w io.Writer) error {
+	ranges := m.Ranges()
+	if ranges == nil {
+		ranges = []Range{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ranges)
+}
+
+// WriteCSV writes a line with the access counts for every used address.
+func (m *Map) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "address,"+strings.Join(accessNames, ","))
+	for addr, a := range m.Access {
+		if a == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "%04x,%d,%d,%d,%d\n", addr,
+			m.Counts[0][addr], m.Counts[1][addr], m.Counts[2][addr], m.Counts[3][addr])
+	}
+	return bw.Flush()
+}
+
+// Image returns the heatmap, a 256x256 image with a pixel per address, the
+// page on the Y axis. Red shows execution, green reads and blue writes, the
+// brighter the more accesses on a log scale.
+func (m *Map) Image() *image.RGBA {
+	var counts [0x10000][3]uint64 // execution, reads, writes
+	var top [3]uint64
+	for addr := range counts {
+		c := &counts[addr]
+		c[0] = uint64(m.Counts[0][addr]) + uint64(m.Counts[1][addr])
+		c[1], c[2] = uint64(m.Counts[2][addr]), uint64(m.Counts[3][addr])
+		for i := range c {
+			top[i] = max(top[i], c[i])
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for addr, c := range counts {
+		img.SetRGBA(addr&0xff, addr>>8, color.RGBA{shade(c[0], top[0]), shade(c[1], top[1]), shade(c[2], top[2]), 0xff})
+	}
+	return img
+}
+
+// shade maps a count to a brightness, used addresses start at a quarter so
+// single accesses stand out.
+func shade(c, top uint64) uint8 {
+	if c == 0 {
+		return 0
+	}
+	return uint8(0x40 + 0xbf*math.Log(float64(c)+1)/math.Log(float64(top)+1))
+}
+
+// WritePNG writes the heatmap scaled up by scale.
+func (m *Map) WritePNG(w io.Writer, scale int) error {
+	src := m.Image()
+	if scale <= 1 {
+		return png.Encode(w, src)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 256*scale, 256*scale))
+	for y := 0; y < 256*scale; y++ {
+		for x := 0; x < 256*scale; x++ {
+			img.SetRGBA(x, y, src.RGBAAt(x/scale, y/scale))
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// WriteFile writes the map to name, in the format of its extension: .json,
+// .csv or .png, the PNG scaled up 4 times.
+func (m *Map) WriteFile(name string) error {
+	var write func(io.Writer) error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		write = m.WriteJSON
+	case ".csv":
+		write = m.WriteCSV
+	case ".png":
+		write = func(w io.Writer) error { return m.WritePNG(w, 4) }
+	default:
+		return fmt.Errorf("coverage: unknown format of %q, want .json, .csv or .png", name)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -3,11 +3,9 @@ package cpu
 import (
 	"fmt"
 	"log/slog"
-	"reflect"
-	"runtime"
 
 	"github.com/jejer/commando64/pkg/c64"
-	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/irq"
 )
 
 const (
@@ -42,97 +40,322 @@ const (
 
 type CPU struct {
 	logger     slog.Logger
-	clock      *clock.Clock
 	mem        c64.MemoryBus
 	pc         uint16
 	a, x, y, p uint8 // registers
 	sp         uint8 // stack pointer
-	cycles     int
-	irqCh      <-chan bool
+	irq        *irq.Controller
+	err        error // set when the CPU halts
+	rdy        bool  // RDY input, read cycles halt while it is low
+
+	// the sequence in progress, pos indexes the micro-op of the next cycle
+	sequence uint8
+	inst     Instruction
+	opcode   uint8
+	program  []microOp
+	pos      int
+	// the access of the current cycle is a dummy read
+	dummyRead bool
+	// internal latches carried between cycles
+	addr, base uint16
+	ptr, data  uint8
+	// interrupt lines sampled at the end of the last two cycles, the CPU
+	// acts on the second to last sample at an instruction boundary
+	irqNow, irqSampled bool
+	nmiNow, nmiSampled bool
+
+	traps  map[uint16]func(cpu *CPU)
+	tracer Tracer
 }
 
-func NewCPU(logger slog.Logger, clock *clock.Clock, m c64.MemoryBus, irq <-chan bool) *CPU {
+// Tracer follows the instructions the CPU runs.
+type Tracer interface {
+	// Instruction is called before the opcode fetch, after the traps.
+	Instruction(cpu *CPU)
+	// Interrupt is called when the CPU starts an IRQ or NMI sequence, the
+	// next instruction is the first of the handler.
+	Interrupt(cpu *CPU, nmi bool)
+	// Halt is called when the CPU jams, err is the *JamError.
+	Halt(cpu *CPU, err error)
+}
+
+// State is the CPU state captured in machine snapshots. Sequence and Step
+// locate the cycle within the instruction or interrupt sequence. A jammed
+// CPU restores jammed on Opcode, one held by RDY stays held.
+type State struct {
+	PC         uint16
+	A, X, Y, P uint8
+	SP         uint8
+	Sequence   uint8
+	Opcode     uint8
+	Step       uint8
+	Addr, Base uint16
+	Ptr, Data  uint8
+	IRQNow     bool
+	IRQSampled bool
+	NMINow     bool
+	NMISampled bool
+	Jammed     bool
+	RDYLow     bool
+}
+
+func NewCPU(logger slog.Logger, m c64.MemoryBus, irq *irq.Controller) *CPU {
 	// https://www.c64-wiki.com/index.php/Reset_(Process)
 	return &CPU{
 		mem:    m,
 		pc:     m.ReadWord(ResetVector),
-		irqCh:  irq,
-		clock:  clock,
-		cycles: 0x6,
+		irq:    irq,
+		rdy:    true,
 		logger: *logger.With("Component", "CPU"),
 	}
 }
 
+func (cpu *CPU) State() State {
+	return State{
+		PC:         cpu.pc,
+		A:          cpu.a,
+		X:          cpu.x,
+		Y:          cpu.y,
+		P:          cpu.p,
+		SP:         cpu.sp,
+		Sequence:   cpu.sequence,
+		Opcode:     cpu.opcode,
+		Step:       uint8(cpu.pos),
+		Addr:       cpu.addr,
+		Base:       cpu.base,
+		Ptr:        cpu.ptr,
+		Data:       cpu.data,
+		IRQNow:     cpu.irqNow,
+		IRQSampled: cpu.irqSampled,
+		NMINow:     cpu.nmiNow,
+		NMISampled: cpu.nmiSampled,
+		Jammed:     cpu.err != nil,
+		RDYLow:     !cpu.rdy,
+	}
+}
+
+func (cpu *CPU) SetState(s State) {
+	cpu.pc = s.PC
+	cpu.a, cpu.x, cpu.y, cpu.p = s.A, s.X, s.Y, s.P
+	cpu.sp = s.SP
+	cpu.sequence, cpu.opcode = s.Sequence, s.Opcode
+	cpu.inst = Instructions[s.Opcode]
+	switch s.Sequence {
+	case seqInstruction:
+		cpu.program = programs[s.Opcode]
+	case seqIRQ, seqNMI:
+		cpu.program = interruptProgram
+	case seqReset:
+		cpu.program = resetProgram
+	default:
+		cpu.program = nil
+	}
+	cpu.pos = min(int(s.Step), len(cpu.program))
+	cpu.addr, cpu.base = s.Addr, s.Base
+	cpu.ptr, cpu.data = s.Ptr, s.Data
+	cpu.irqNow, cpu.irqSampled = s.IRQNow, s.IRQSampled
+	cpu.nmiNow, cpu.nmiSampled = s.NMINow, s.NMISampled
+	cpu.rdy = !s.RDYLow
+	cpu.err = nil
+	if s.Jammed {
+		cpu.err = &JamError{Opcode: s.Opcode, State: s}
+	}
+}
+
+// Reset starts the reset sequence, it takes 7 cycles before the first
+// instruction is fetched from the reset vector.
 func (cpu *CPU) Reset() {
 	cpu.a, cpu.x, cpu.y, cpu.p, cpu.sp = 0, 0, 0, 0, 0
-	cpu.pc = cpu.mem.ReadWord(ResetVector)
-	cpu.cycles = 0x6
-}
-
-func (cpu *CPU) Run() {
-	for {
-		select {
-		case isNMI := <-cpu.irqCh:
-			if isNMI {
-				cpu.NMI()
-			} else {
-				cpu.IRQ()
-			}
-		case q := <-cpu.clock.CPU:
-			cpu.cycles -= q
-			for cpu.cycles <= 0 {
-				cpu.step()
-			}
+	cpu.err = nil
+	cpu.irqNow, cpu.irqSampled = false, false
+	cpu.nmiNow, cpu.nmiSampled = false, false
+	cpu.start(seqReset, resetProgram)
+}
+
+// SetRDY drives the RDY input. While it is low the CPU halts on its next
+// read cycle, write cycles still go ahead.
+func (cpu *CPU) SetRDY(ready bool) {
+	cpu.rdy = ready
+}
+
+// Tick advances the CPU by one cycle, which is one bus access.
+// A halted CPU does nothing until it is reset.
+func (cpu *CPU) Tick() {
+	if cpu.err != nil {
+		return
+	}
+	if cpu.pos == len(cpu.program) {
+		if !cpu.rdy {
+			return
 		}
+		cpu.begin()
+	} else {
+		op := cpu.program[cpu.pos]
+		if !cpu.rdy && !op.write {
+			return
+		}
+		cpu.pos++
+		cpu.dummyRead = op.dummy
+		op.fn(cpu)
 	}
+	cpu.poll()
 }
 
-var CPU_DEBUG_PRINT = 0
+// step runs the cycles up to the end of the next instruction or interrupt
+// sequence and returns their number.
+func (cpu *CPU) step() int {
+	cycles := 1
+	cpu.Tick()
+	for !cpu.InstructionDone() && cpu.err == nil {
+		cpu.Tick()
+		cycles++
+	}
+	return cycles
+}
+
+// DummyRead reports whether the bus access of the current cycle is a dummy
+// read, one whose value the CPU discards. Memory hooks use it to tell them
+// from the reads of operands and data.
+func (cpu *CPU) DummyRead() bool {
+	return cpu.dummyRead
+}
 
-func (cpu *CPU) step() {
-	if cpu.pc == 0xe5d4 {
-		CPU_DEBUG_PRINT = 1
+// InstructionDone reports whether the current instruction has finished,
+// i.e. the next CPU cycle starts a new one.
+func (cpu *CPU) InstructionDone() bool {
+	return cpu.pos == len(cpu.program)
+}
+
+// Err returns the error that halted the CPU, nil while it is running.
+// It is a *JamError.
+func (cpu *CPU) Err() error {
+	return cpu.err
+}
+
+// AddTrap calls fn whenever an instruction at addr is about to be fetched.
+// fn may change the CPU state, e.g. to skip a ROM routine, the CPU fetches
+// from the PC left by fn. A later trap at the same address replaces it.
+func (cpu *CPU) AddTrap(addr uint16, fn func(cpu *CPU)) {
+	if cpu.traps == nil {
+		cpu.traps = make(map[uint16]func(cpu *CPU))
 	}
-	instraCode := cpu.fetchOP()
-	instruction, exist := Instructions[instraCode]
-	if CPU_DEBUG_PRINT == 1 {
-		CPU_DEBUG_PRINT = 2
-		cpu.logger.Debug(`PC-1|   OP    |A |X |Y |P NV.BDIZC|SP|SD| `)
+	cpu.traps[addr] = fn
+}
+
+func (cpu *CPU) RemoveTrap(addr uint16) {
+	delete(cpu.traps, addr)
+}
+
+// Tracers calls several tracers in order.
+type Tracers []Tracer
+
+func (ts Tracers) Instruction(cpu *CPU) {
+	for _, t := range ts {
+		t.Instruction(cpu)
 	}
-	if CPU_DEBUG_PRINT == 2 {
-		cpu.logger.Debug(fmt.Sprintf("%04x|%s%02x%02x%02x|%02x|%02x|%02x|%02x%08b|%02x|%02x| ", cpu.pc-1, runtime.FuncForPC(reflect.ValueOf(instruction.fn).Pointer()).Name()[36:39], cpu.mem.Read(cpu.pc-1), cpu.mem.Read(cpu.pc), cpu.mem.Read(cpu.pc+1), cpu.a, cpu.x, cpu.y, cpu.p, cpu.p, cpu.sp, cpu.mem.Read(StackLow+uint16(cpu.sp)+1)))
+}
+
+func (ts Tracers) Interrupt(cpu *CPU, nmi bool) {
+	for _, t := range ts {
+		t.Interrupt(cpu, nmi)
 	}
-	if !exist {
-		cpu.logger.Error("Instruction Unsupported", "instruction", instruction)
-		panic(1)
+}
+
+func (ts Tracers) Halt(cpu *CPU, err error) {
+	for _, t := range ts {
+		t.Halt(cpu, err)
 	}
-	instruction.fn(cpu, instruction.mode)
-	cpu.cycles += int(instruction.cycles)
 }
 
-func (cpu *CPU) IRQ() {
-	if cpu.hasFlag(FlagI) {
-		return
+// SetTracer sets the tracer, nil removes it.
+func (cpu *CPU) SetTracer(t Tracer) {
+	cpu.tracer = t
+}
+
+// Return continues at the return address on the stack, as RTS does.
+// Traps use it to skip a subroutine.
+func (cpu *CPU) Return() {
+	pc := uint16(cpu.pop())
+	pc |= uint16(cpu.pop()) << 8
+	cpu.pc = pc + 1
+}
+
+// Halted reports whether the CPU is jammed, only Reset recovers it.
+func (cpu *CPU) Halted() bool {
+	return cpu.err != nil
+}
+
+// JamError reports a CPU halted by a JAM opcode, with the registers at that
+// point and PC on the opcode.
+type JamError struct {
+	Opcode uint8
+	State  State
+}
+
+func (e *JamError) Error() string {
+	s := e.State
+	return fmt.Sprintf("cpu: JAM $%02x at $%04x (A=%02x X=%02x Y=%02x P=%08b SP=%02x)",
+		e.Opcode, s.PC, s.A, s.X, s.Y, s.P, s.SP)
+}
+
+// jam halts the CPU on the opcode just fetched.
+func (cpu *CPU) jam(opcode uint8) {
+	cpu.pc--
+	cpu.finish()
+	cpu.err = &JamError{Opcode: opcode, State: cpu.State()}
+	cpu.logger.Error("CPU jammed", "err", cpu.err)
+	if cpu.tracer != nil {
+		cpu.tracer.Halt(cpu, cpu.err)
 	}
-	cpu.interrupt(false, IRQVector)
-	cpu.cycles += 7
 }
 
-func (cpu *CPU) NMI() {
-	cpu.interrupt(false, NMIVector)
-	cpu.cycles += 7
+// poll samples the interrupt lines at the end of a cycle.
+func (cpu *CPU) poll() {
+	cpu.irqSampled, cpu.irqNow = cpu.irqNow, cpu.irq.IRQ() && !cpu.hasFlag(FlagI)
+	cpu.nmiSampled, cpu.nmiNow = cpu.nmiNow, cpu.irq.NMI()
 }
 
-func (cpu *CPU) interrupt(brk bool, vector uint16) {
-	cpu.push(uint8((cpu.pc >> 8) & 0xff))
-	cpu.push(uint8(cpu.pc & 0xff))
-	if brk {
-		cpu.push(cpu.p | FlagB)
-	} else {
-		cpu.push(cpu.p &^ FlagB)
+func (cpu *CPU) start(sequence uint8, program []microOp) {
+	cpu.sequence = sequence
+	cpu.program = program
+	cpu.pos = 0
+}
+
+// begin runs the first cycle at an instruction boundary: the opcode fetch,
+// or the discarded fetch of an interrupt sequence if an interrupt was
+// sampled in time. An NMI edge takes precedence over the IRQ level.
+func (cpu *CPU) begin() {
+	if cpu.nmiSampled && cpu.irq.TakeNMI() {
+		cpu.dummyRead = true
+		cpu.mem.Read(cpu.pc)
+		cpu.start(seqNMI, interruptProgram)
+		if cpu.tracer != nil {
+			cpu.tracer.Interrupt(cpu, true)
+		}
+		return
+	}
+	if cpu.irqSampled {
+		cpu.dummyRead = true
+		cpu.mem.Read(cpu.pc)
+		cpu.start(seqIRQ, interruptProgram)
+		if cpu.tracer != nil {
+			cpu.tracer.Interrupt(cpu, false)
+		}
+		return
+	}
+
+	if trap, ok := cpu.traps[cpu.pc]; ok {
+		trap(cpu)
 	}
-	cpu.setFlag(FlagI, true)
-	cpu.pc = cpu.mem.ReadWord(vector)
+
+	if cpu.tracer != nil {
+		cpu.tracer.Instruction(cpu)
+	}
+	cpu.dummyRead = false
+	instraCode := cpu.fetchOP()
+	cpu.opcode = instraCode
+	cpu.inst = Instructions[instraCode]
+	cpu.start(seqInstruction, programs[instraCode])
 }
 
 func (cpu *CPU) fetchOP() byte {
@@ -141,12 +364,6 @@ func (cpu *CPU) fetchOP() byte {
 	return v
 }
 
-func (cpu *CPU) fetchWord() uint16 {
-	v := cpu.mem.ReadWord(cpu.pc)
-	cpu.pc += 2
-	return v
-}
-
 // sp is in uint8 range, overflow/underflow is not possiable
 func (cpu *CPU) push(v byte) {
 	// cpu.logger.Debug("push", "current sp", cpu.sp, "value", v)
@@ -174,58 +391,15 @@ func (cpu *CPU) hasFlag(flag uint8) bool {
 	return (cpu.p & flag) != 0
 }
 
+// loadByte returns the operand read by the cycles before and its address.
 func (cpu *CPU) loadByte(mode AddressingMode) (byte, uint16) {
-	// cpu.logger.Debug("loadByte", "mode", mode)
-
-	var v byte = 0
-	var addr uint16 = 0
-	switch mode {
-	case Accumulator:
-		v = cpu.a
-	case Immidiate:
-		v = cpu.fetchOP()
-	case Absolute:
-		addr = cpu.fetchWord()
-		v = cpu.mem.Read(addr)
-	case IndexedAbsoluteX:
-		addr = cpu.fetchWord()
-		addr += uint16(cpu.x)
-		v = cpu.mem.Read(addr)
-	case IndexedAbsoluteY:
-		addr = cpu.fetchWord()
-		addr += uint16(cpu.y)
-		v = cpu.mem.Read(addr)
-	case Zeropage:
-		addr = uint16(cpu.fetchOP())
-		v = cpu.mem.Read(addr)
-	case IndexedZeropageX:
-		addr = uint16(cpu.fetchOP())
-		addr += uint16(cpu.x)
-		addr = addr & 0xff
-		v = cpu.mem.Read(addr)
-	case IndexedZeropageY:
-		addr = uint16(cpu.fetchOP())
-		addr += uint16(cpu.y)
-		addr = addr & 0xff
-		v = cpu.mem.Read(addr)
-	case IndexedIndirectX:
-		addr = uint16(cpu.fetchOP())
-		addr += uint16(cpu.x)
-		addr = cpu.mem.ReadWord(addr & 0xff)
-		v = cpu.mem.Read(addr)
-	case IndirectIndexedY:
-		addr = uint16(cpu.fetchOP())
-		addr = cpu.mem.ReadWord(addr)
-		addr += uint16(cpu.y)
-		v = cpu.mem.Read(addr)
-	case AbsoluteIndirect: // only get address
-		addr = cpu.fetchWord()
-		addr = cpu.mem.ReadWord(addr)
-	case Relative:
-		addr = cpu.pc + uint16(int8(cpu.fetchOP())) // offset could be nagative
-	default:
-		cpu.logger.Error("unsupported addressing mode", "mode", mode)
+	if mode == Accumulator {
+		return cpu.a, 0
 	}
+	return cpu.data, cpu.addr
+}
 
-	return v, addr
+// store sets the value written by the next cycle.
+func (cpu *CPU) store(v byte) {
+	cpu.data = v
 }
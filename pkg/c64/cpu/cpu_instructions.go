@@ -21,167 +21,298 @@ const (
 	IndirectIndexedY
 )
 
+// unstableConst is the value ANE and LXA OR into the accumulator,
+// it differs between chips and with temperature.
+const unstableConst uint8 = 0xee
+
 type InstraFunc func(cpu *CPU, mode AddressingMode)
 
+// Access is how an instruction uses the memory its addressing mode points at.
+type Access uint8
+
+const (
+	AccessNone Access = iota // no memory operand, or immediate, branches and jumps
+	AccessRead
+	AccessWrite
+	AccessRMW // read-modify-write
+)
+
 type Instruction struct {
-	fn     InstraFunc
-	mode   AddressingMode
-	cycles uint8
-}
-
-var Instructions = map[byte]Instruction{
-	0x00: {BRK, Implied, 7},
-	0x01: {ORA, IndexedIndirectX, 6},
-	// 0x02: Undefined, omitted below
-	0x05: {ORA, Zeropage, 3},
-	0x06: {ASL, Zeropage, 5},
-	0x08: {PHP, Implied, 3},
-	0x09: {ORA, Immidiate, 2},
-	0x0a: {ASL, Accumulator, 2},
-	0x0d: {ORA, Absolute, 4},
-	0x0e: {ASL, Absolute, 6},
-	0x10: {BPL, Relative, 2},
-	0x11: {ORA, IndirectIndexedY, 5},
-	0x15: {ORA, IndexedZeropageX, 4},
-	0x16: {ASL, IndexedZeropageX, 6},
-	0x18: {CLC, Implied, 2},
-	0x19: {ORA, IndexedAbsoluteY, 4},
-	0x1d: {ORA, IndexedAbsoluteX, 4},
-	0x1e: {ASL, IndexedAbsoluteX, 7},
-	0x20: {JSR, Absolute, 6},
-	0x21: {AND, IndexedIndirectX, 6},
-	0x24: {BIT, Zeropage, 3},
-	0x25: {AND, Zeropage, 3},
-	0x26: {ROL, Zeropage, 5},
-	0x28: {PLP, Implied, 4},
-	0x29: {AND, Immidiate, 2},
-	0x2a: {ROL, Accumulator, 2},
-	0x2c: {BIT, Absolute, 4},
-	0x2d: {AND, Absolute, 4},
-	0x2e: {ROL, Absolute, 6},
-	0x30: {BMI, Relative, 2},
-	0x31: {AND, IndirectIndexedY, 5},
-	0x35: {AND, IndexedZeropageX, 4},
-	0x36: {ROL, IndexedZeropageX, 6},
-	0x38: {SEC, Implied, 2},
-	0x39: {AND, IndexedAbsoluteY, 4},
-	0x3d: {AND, IndexedAbsoluteX, 4},
-	0x3e: {ROL, IndexedAbsoluteX, 7},
-	0x40: {RTI, Implied, 6},
-	0x41: {EOR, IndexedIndirectX, 6},
-	0x45: {EOR, Zeropage, 3},
-	0x46: {LSR, Zeropage, 5},
-	0x48: {PHA, Implied, 3},
-	0x49: {EOR, Immidiate, 2},
-	0x4a: {LSR, Accumulator, 2},
-	0x4c: {JMP, Absolute, 3},
-	0x4d: {EOR, Absolute, 4},
-	0x4e: {LSR, Absolute, 6},
-	0x50: {BVC, Relative, 2},
-	0x51: {EOR, IndirectIndexedY, 5},
-	0x55: {EOR, IndexedZeropageX, 4},
-	0x56: {LSR, IndexedZeropageX, 6},
-	0x58: {CLI, Implied, 2},
-	0x59: {EOR, IndexedAbsoluteY, 4},
-	0x5d: {EOR, IndexedAbsoluteX, 4},
-	0x5e: {LSR, IndexedAbsoluteX, 7},
-	0x60: {RTS, Implied, 6},
-	0x61: {ADC, IndexedIndirectX, 6},
-	0x65: {ADC, Zeropage, 3},
-	0x66: {ROR, Zeropage, 5},
-	0x68: {PLA, Implied, 4},
-	0x69: {ADC, Immidiate, 2},
-	0x6a: {ROR, Accumulator, 2},
-	0x6c: {JMP, AbsoluteIndirect, 5},
-	0x6d: {ADC, Absolute, 4},
-	0x6e: {ROR, Absolute, 6},
-	0x70: {BVS, Relative, 2},
-	0x71: {ADC, IndirectIndexedY, 5},
-	0x75: {ADC, IndexedZeropageX, 4},
-	0x76: {ROR, IndexedZeropageX, 6},
-	0x78: {SEI, Implied, 2},
-	0x79: {ADC, IndexedAbsoluteY, 4},
-	0x7d: {ADC, IndexedAbsoluteX, 4},
-	0x7e: {ROR, IndexedAbsoluteX, 7},
-	0x81: {STA, IndexedIndirectX, 6},
-	0x84: {STY, Zeropage, 3},
-	0x85: {STA, Zeropage, 3},
-	0x86: {STX, Zeropage, 3},
-	0x88: {DEY, Implied, 2},
-	0x8a: {TXA, Implied, 2},
-	0x8c: {STY, Absolute, 4},
-	0x8d: {STA, Absolute, 4},
-	0x8e: {STX, Absolute, 4},
-	0x90: {BCC, Relative, 2},
-	0x91: {STA, IndirectIndexedY, 6},
-	0x94: {STY, IndexedZeropageX, 4},
-	0x95: {STA, IndexedZeropageX, 4},
-	0x96: {STX, IndexedZeropageY, 4},
-	0x98: {TYA, Implied, 2},
-	0x99: {STA, IndexedAbsoluteY, 5},
-	0x9a: {TXS, Implied, 2},
-	0x9d: {STA, IndexedAbsoluteX, 5},
-	0xa0: {LDY, Immidiate, 2},
-	0xa1: {LDA, IndexedIndirectX, 6},
-	0xa2: {LDX, Immidiate, 2},
-	0xa4: {LDY, Zeropage, 3},
-	0xa5: {LDA, Zeropage, 3},
-	0xa6: {LDX, Zeropage, 3},
-	0xa8: {TAY, Implied, 2},
-	0xa9: {LDA, Immidiate, 2},
-	0xaa: {TAX, Implied, 2},
-	0xac: {LDY, Absolute, 4},
-	0xad: {LDA, Absolute, 4},
-	0xae: {LDX, Absolute, 4},
-	0xb0: {BCS, Relative, 2},
-	0xb1: {LDA, IndirectIndexedY, 5},
-	0xb4: {LDY, IndexedZeropageX, 4},
-	0xb5: {LDA, IndexedZeropageX, 4},
-	0xb6: {LDX, IndexedZeropageY, 4},
-	0xb8: {CLV, Implied, 2},
-	0xb9: {LDA, IndexedAbsoluteY, 4},
-	0xba: {TSX, Implied, 2},
-	0xbc: {LDY, IndexedAbsoluteX, 4},
-	0xbd: {LDA, IndexedAbsoluteX, 4},
-	0xbe: {LDX, IndexedAbsoluteY, 4},
-	0xc0: {CPY, Immidiate, 2},
-	0xc1: {CMP, IndexedIndirectX, 6},
-	0xc4: {CPY, Zeropage, 3},
-	0xc5: {CMP, Zeropage, 3},
-	0xc6: {DEC, Zeropage, 5},
-	0xc8: {INY, Implied, 2},
-	0xc9: {CMP, Immidiate, 2},
-	0xca: {DEX, Implied, 2},
-	0xcc: {CPY, Absolute, 4},
-	0xcd: {CMP, Absolute, 4},
-	0xce: {DEC, Absolute, 6},
-	0xd0: {BNE, Relative, 2},
-	0xd1: {CMP, IndirectIndexedY, 5},
-	0xd5: {CMP, IndexedZeropageX, 4},
-	0xd6: {DEC, IndexedZeropageX, 6},
-	0xd8: {CLD, Implied, 2},
-	0xd9: {CMP, IndexedAbsoluteY, 4},
-	0xdd: {CMP, IndexedAbsoluteX, 4},
-	0xde: {DEC, IndexedAbsoluteX, 7},
-	0xe0: {CPX, Immidiate, 2},
-	0xe1: {SBC, IndexedIndirectX, 6},
-	0xe4: {CPX, Zeropage, 3},
-	0xe5: {SBC, Zeropage, 3},
-	0xe6: {INC, Zeropage, 5},
-	0xe8: {INX, Implied, 2},
-	0xe9: {SBC, Immidiate, 2},
-	0xea: {NOP, Implied, 2},
-	0xec: {CPX, Absolute, 4},
-	0xed: {SBC, Absolute, 4},
-	0xee: {INC, Absolute, 6},
-	0xf0: {BEQ, Relative, 2},
-	0xf1: {SBC, IndirectIndexedY, 5},
-	0xf5: {SBC, IndexedZeropageX, 4},
-	0xf6: {INC, IndexedZeropageX, 6},
-	0xf8: {SED, Implied, 2},
-	0xf9: {SBC, IndexedAbsoluteY, 4},
-	0xfd: {SBC, IndexedAbsoluteX, 4},
-	0xfe: {INC, IndexedAbsoluteX, 7},
+	name    string // for the undocumented opcodes as in "No More Secrets"
+	fn      InstraFunc
+	mode    AddressingMode
+	cycles  uint8 // without the page crossing and branch penalties
+	access  Access
+	illegal bool // undocumented
+}
+
+func (i Instruction) Name() string         { return i.name }
+func (i Instruction) Illegal() bool        { return i.illegal }
+func (i Instruction) Mode() AddressingMode { return i.mode }
+func (i Instruction) Cycles() uint8        { return i.cycles }
+func (i Instruction) Access() Access       { return i.access }
+
+// Instructions covers all 256 opcodes of the NMOS 6510, the undocumented ones
+// as described in "No More Secrets" (https://csdb.dk/release/?id=198357).
+// JAM never completes so it has no cycle count. It is an array indexed by the
+// opcode, the CPU looks it up on every instruction.
+var Instructions = [256]Instruction{
+	0x00: {"BRK", BRK, Implied, 7, AccessNone, false},
+	0x01: {"ORA", ORA, IndexedIndirectX, 6, AccessRead, false},
+	0x02: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x03: {"SLO", SLO, IndexedIndirectX, 8, AccessRMW, true},
+	0x04: {"NOP", NOP, Zeropage, 3, AccessRead, true},
+	0x05: {"ORA", ORA, Zeropage, 3, AccessRead, false},
+	0x06: {"ASL", ASL, Zeropage, 5, AccessRMW, false},
+	0x07: {"SLO", SLO, Zeropage, 5, AccessRMW, true},
+	0x08: {"PHP", PHP, Implied, 3, AccessNone, false},
+	0x09: {"ORA", ORA, Immidiate, 2, AccessRead, false},
+	0x0a: {"ASL", ASL, Accumulator, 2, AccessNone, false},
+	0x0b: {"ANC", ANC, Immidiate, 2, AccessRead, true},
+	0x0c: {"NOP", NOP, Absolute, 4, AccessRead, true},
+	0x0d: {"ORA", ORA, Absolute, 4, AccessRead, false},
+	0x0e: {"ASL", ASL, Absolute, 6, AccessRMW, false},
+	0x0f: {"SLO", SLO, Absolute, 6, AccessRMW, true},
+	0x10: {"BPL", BPL, Relative, 2, AccessNone, false},
+	0x11: {"ORA", ORA, IndirectIndexedY, 5, AccessRead, false},
+	0x12: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x13: {"SLO", SLO, IndirectIndexedY, 8, AccessRMW, true},
+	0x14: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0x15: {"ORA", ORA, IndexedZeropageX, 4, AccessRead, false},
+	0x16: {"ASL", ASL, IndexedZeropageX, 6, AccessRMW, false},
+	0x17: {"SLO", SLO, IndexedZeropageX, 6, AccessRMW, true},
+	0x18: {"CLC", CLC, Implied, 2, AccessNone, false},
+	0x19: {"ORA", ORA, IndexedAbsoluteY, 4, AccessRead, false},
+	0x1a: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0x1b: {"SLO", SLO, IndexedAbsoluteY, 7, AccessRMW, true},
+	0x1c: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0x1d: {"ORA", ORA, IndexedAbsoluteX, 4, AccessRead, false},
+	0x1e: {"ASL", ASL, IndexedAbsoluteX, 7, AccessRMW, false},
+	0x1f: {"SLO", SLO, IndexedAbsoluteX, 7, AccessRMW, true},
+	0x20: {"JSR", JSR, Absolute, 6, AccessNone, false},
+	0x21: {"AND", AND, IndexedIndirectX, 6, AccessRead, false},
+	0x22: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x23: {"RLA", RLA, IndexedIndirectX, 8, AccessRMW, true},
+	0x24: {"BIT", BIT, Zeropage, 3, AccessRead, false},
+	0x25: {"AND", AND, Zeropage, 3, AccessRead, false},
+	0x26: {"ROL", ROL, Zeropage, 5, AccessRMW, false},
+	0x27: {"RLA", RLA, Zeropage, 5, AccessRMW, true},
+	0x28: {"PLP", PLP, Implied, 4, AccessNone, false},
+	0x29: {"AND", AND, Immidiate, 2, AccessRead, false},
+	0x2a: {"ROL", ROL, Accumulator, 2, AccessNone, false},
+	0x2b: {"ANC", ANC, Immidiate, 2, AccessRead, true},
+	0x2c: {"BIT", BIT, Absolute, 4, AccessRead, false},
+	0x2d: {"AND", AND, Absolute, 4, AccessRead, false},
+	0x2e: {"ROL", ROL, Absolute, 6, AccessRMW, false},
+	0x2f: {"RLA", RLA, Absolute, 6, AccessRMW, true},
+	0x30: {"BMI", BMI, Relative, 2, AccessNone, false},
+	0x31: {"AND", AND, IndirectIndexedY, 5, AccessRead, false},
+	0x32: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x33: {"RLA", RLA, IndirectIndexedY, 8, AccessRMW, true},
+	0x34: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0x35: {"AND", AND, IndexedZeropageX, 4, AccessRead, false},
+	0x36: {"ROL", ROL, IndexedZeropageX, 6, AccessRMW, false},
+	0x37: {"RLA", RLA, IndexedZeropageX, 6, AccessRMW, true},
+	0x38: {"SEC", SEC, Implied, 2, AccessNone, false},
+	0x39: {"AND", AND, IndexedAbsoluteY, 4, AccessRead, false},
+	0x3a: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0x3b: {"RLA", RLA, IndexedAbsoluteY, 7, AccessRMW, true},
+	0x3c: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0x3d: {"AND", AND, IndexedAbsoluteX, 4, AccessRead, false},
+	0x3e: {"ROL", ROL, IndexedAbsoluteX, 7, AccessRMW, false},
+	0x3f: {"RLA", RLA, IndexedAbsoluteX, 7, AccessRMW, true},
+	0x40: {"RTI", RTI, Implied, 6, AccessNone, false},
+	0x41: {"EOR", EOR, IndexedIndirectX, 6, AccessRead, false},
+	0x42: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x43: {"SRE", SRE, IndexedIndirectX, 8, AccessRMW, true},
+	0x44: {"NOP", NOP, Zeropage, 3, AccessRead, true},
+	0x45: {"EOR", EOR, Zeropage, 3, AccessRead, false},
+	0x46: {"LSR", LSR, Zeropage, 5, AccessRMW, false},
+	0x47: {"SRE", SRE, Zeropage, 5, AccessRMW, true},
+	0x48: {"PHA", PHA, Implied, 3, AccessNone, false},
+	0x49: {"EOR", EOR, Immidiate, 2, AccessRead, false},
+	0x4a: {"LSR", LSR, Accumulator, 2, AccessNone, false},
+	0x4b: {"ALR", ALR, Immidiate, 2, AccessRead, true},
+	0x4c: {"JMP", JMP, Absolute, 3, AccessNone, false},
+	0x4d: {"EOR", EOR, Absolute, 4, AccessRead, false},
+	0x4e: {"LSR", LSR, Absolute, 6, AccessRMW, false},
+	0x4f: {"SRE", SRE, Absolute, 6, AccessRMW, true},
+	0x50: {"BVC", BVC, Relative, 2, AccessNone, false},
+	0x51: {"EOR", EOR, IndirectIndexedY, 5, AccessRead, false},
+	0x52: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x53: {"SRE", SRE, IndirectIndexedY, 8, AccessRMW, true},
+	0x54: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0x55: {"EOR", EOR, IndexedZeropageX, 4, AccessRead, false},
+	0x56: {"LSR", LSR, IndexedZeropageX, 6, AccessRMW, false},
+	0x57: {"SRE", SRE, IndexedZeropageX, 6, AccessRMW, true},
+	0x58: {"CLI", CLI, Implied, 2, AccessNone, false},
+	0x59: {"EOR", EOR, IndexedAbsoluteY, 4, AccessRead, false},
+	0x5a: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0x5b: {"SRE", SRE, IndexedAbsoluteY, 7, AccessRMW, true},
+	0x5c: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0x5d: {"EOR", EOR, IndexedAbsoluteX, 4, AccessRead, false},
+	0x5e: {"LSR", LSR, IndexedAbsoluteX, 7, AccessRMW, false},
+	0x5f: {"SRE", SRE, IndexedAbsoluteX, 7, AccessRMW, true},
+	0x60: {"RTS", RTS, Implied, 6, AccessNone, false},
+	0x61: {"ADC", ADC, IndexedIndirectX, 6, AccessRead, false},
+	0x62: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x63: {"RRA", RRA, IndexedIndirectX, 8, AccessRMW, true},
+	0x64: {"NOP", NOP, Zeropage, 3, AccessRead, true},
+	0x65: {"ADC", ADC, Zeropage, 3, AccessRead, false},
+	0x66: {"ROR", ROR, Zeropage, 5, AccessRMW, false},
+	0x67: {"RRA", RRA, Zeropage, 5, AccessRMW, true},
+	0x68: {"PLA", PLA, Implied, 4, AccessNone, false},
+	0x69: {"ADC", ADC, Immidiate, 2, AccessRead, false},
+	0x6a: {"ROR", ROR, Accumulator, 2, AccessNone, false},
+	0x6b: {"ARR", ARR, Immidiate, 2, AccessRead, true},
+	0x6c: {"JMP", JMP, AbsoluteIndirect, 5, AccessNone, false},
+	0x6d: {"ADC", ADC, Absolute, 4, AccessRead, false},
+	0x6e: {"ROR", ROR, Absolute, 6, AccessRMW, false},
+	0x6f: {"RRA", RRA, Absolute, 6, AccessRMW, true},
+	0x70: {"BVS", BVS, Relative, 2, AccessNone, false},
+	0x71: {"ADC", ADC, IndirectIndexedY, 5, AccessRead, false},
+	0x72: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x73: {"RRA", RRA, IndirectIndexedY, 8, AccessRMW, true},
+	0x74: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0x75: {"ADC", ADC, IndexedZeropageX, 4, AccessRead, false},
+	0x76: {"ROR", ROR, IndexedZeropageX, 6, AccessRMW, false},
+	0x77: {"RRA", RRA, IndexedZeropageX, 6, AccessRMW, true},
+	0x78: {"SEI", SEI, Implied, 2, AccessNone, false},
+	0x79: {"ADC", ADC, IndexedAbsoluteY, 4, AccessRead, false},
+	0x7a: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0x7b: {"RRA", RRA, IndexedAbsoluteY, 7, AccessRMW, true},
+	0x7c: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0x7d: {"ADC", ADC, IndexedAbsoluteX, 4, AccessRead, false},
+	0x7e: {"ROR", ROR, IndexedAbsoluteX, 7, AccessRMW, false},
+	0x7f: {"RRA", RRA, IndexedAbsoluteX, 7, AccessRMW, true},
+	0x80: {"NOP", NOP, Immidiate, 2, AccessRead, true},
+	0x81: {"STA", STA, IndexedIndirectX, 6, AccessWrite, false},
+	0x82: {"NOP", NOP, Immidiate, 2, AccessRead, true},
+	0x83: {"SAX", SAX, IndexedIndirectX, 6, AccessWrite, true},
+	0x84: {"STY", STY, Zeropage, 3, AccessWrite, false},
+	0x85: {"STA", STA, Zeropage, 3, AccessWrite, false},
+	0x86: {"STX", STX, Zeropage, 3, AccessWrite, false},
+	0x87: {"SAX", SAX, Zeropage, 3, AccessWrite, true},
+	0x88: {"DEY", DEY, Implied, 2, AccessNone, false},
+	0x89: {"NOP", NOP, Immidiate, 2, AccessRead, true},
+	0x8a: {"TXA", TXA, Implied, 2, AccessNone, false},
+	0x8b: {"ANE", ANE, Immidiate, 2, AccessRead, true},
+	0x8c: {"STY", STY, Absolute, 4, AccessWrite, false},
+	0x8d: {"STA", STA, Absolute, 4, AccessWrite, false},
+	0x8e: {"STX", STX, Absolute, 4, AccessWrite, false},
+	0x8f: {"SAX", SAX, Absolute, 4, AccessWrite, true},
+	0x90: {"BCC", BCC, Relative, 2, AccessNone, false},
+	0x91: {"STA", STA, IndirectIndexedY, 6, AccessWrite, false},
+	0x92: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0x93: {"SHA", SHA, IndirectIndexedY, 6, AccessWrite, true},
+	0x94: {"STY", STY, IndexedZeropageX, 4, AccessWrite, false},
+	0x95: {"STA", STA, IndexedZeropageX, 4, AccessWrite, false},
+	0x96: {"STX", STX, IndexedZeropageY, 4, AccessWrite, false},
+	0x97: {"SAX", SAX, IndexedZeropageY, 4, AccessWrite, true},
+	0x98: {"TYA", TYA, Implied, 2, AccessNone, false},
+	0x99: {"STA", STA, IndexedAbsoluteY, 5, AccessWrite, false},
+	0x9a: {"TXS", TXS, Implied, 2, AccessNone, false},
+	0x9b: {"TAS", TAS, IndexedAbsoluteY, 5, AccessWrite, true},
+	0x9c: {"SHY", SHY, IndexedAbsoluteX, 5, AccessWrite, true},
+	0x9d: {"STA", STA, IndexedAbsoluteX, 5, AccessWrite, false},
+	0x9e: {"SHX", SHX, IndexedAbsoluteY, 5, AccessWrite, true},
+	0x9f: {"SHA", SHA, IndexedAbsoluteY, 5, AccessWrite, true},
+	0xa0: {"LDY", LDY, Immidiate, 2, AccessRead, false},
+	0xa1: {"LDA", LDA, IndexedIndirectX, 6, AccessRead, false},
+	0xa2: {"LDX", LDX, Immidiate, 2, AccessRead, false},
+	0xa3: {"LAX", LAX, IndexedIndirectX, 6, AccessRead, true},
+	0xa4: {"LDY", LDY, Zeropage, 3, AccessRead, false},
+	0xa5: {"LDA", LDA, Zeropage, 3, AccessRead, false},
+	0xa6: {"LDX", LDX, Zeropage, 3, AccessRead, false},
+	0xa7: {"LAX", LAX, Zeropage, 3, AccessRead, true},
+	0xa8: {"TAY", TAY, Implied, 2, AccessNone, false},
+	0xa9: {"LDA", LDA, Immidiate, 2, AccessRead, false},
+	0xaa: {"TAX", TAX, Implied, 2, AccessNone, false},
+	0xab: {"LXA", LXA, Immidiate, 2, AccessRead, true},
+	0xac: {"LDY", LDY, Absolute, 4, AccessRead, false},
+	0xad: {"LDA", LDA, Absolute, 4, AccessRead, false},
+	0xae: {"LDX", LDX, Absolute, 4, AccessRead, false},
+	0xaf: {"LAX", LAX, Absolute, 4, AccessRead, true},
+	0xb0: {"BCS", BCS, Relative, 2, AccessNone, false},
+	0xb1: {"LDA", LDA, IndirectIndexedY, 5, AccessRead, false},
+	0xb2: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0xb3: {"LAX", LAX, IndirectIndexedY, 5, AccessRead, true},
+	0xb4: {"LDY", LDY, IndexedZeropageX, 4, AccessRead, false},
+	0xb5: {"LDA", LDA, IndexedZeropageX, 4, AccessRead, false},
+	0xb6: {"LDX", LDX, IndexedZeropageY, 4, AccessRead, false},
+	0xb7: {"LAX", LAX, IndexedZeropageY, 4, AccessRead, true},
+	0xb8: {"CLV", CLV, Implied, 2, AccessNone, false},
+	0xb9: {"LDA", LDA, IndexedAbsoluteY, 4, AccessRead, false},
+	0xba: {"TSX", TSX, Implied, 2, AccessNone, false},
+	0xbb: {"LAS", LAS, IndexedAbsoluteY, 4, AccessRead, true},
+	0xbc: {"LDY", LDY, IndexedAbsoluteX, 4, AccessRead, false},
+	0xbd: {"LDA", LDA, IndexedAbsoluteX, 4, AccessRead, false},
+	0xbe: {"LDX", LDX, IndexedAbsoluteY, 4, AccessRead, false},
+	0xbf: {"LAX", LAX, IndexedAbsoluteY, 4, AccessRead, true},
+	0xc0: {"CPY", CPY, Immidiate, 2, AccessRead, false},
+	0xc1: {"CMP", CMP, IndexedIndirectX, 6, AccessRead, false},
+	0xc2: {"NOP", NOP, Immidiate, 2, AccessRead, true},
+	0xc3: {"DCP", DCP, IndexedIndirectX, 8, AccessRMW, true},
+	0xc4: {"CPY", CPY, Zeropage, 3, AccessRead, false},
+	0xc5: {"CMP", CMP, Zeropage, 3, AccessRead, false},
+	0xc6: {"DEC", DEC, Zeropage, 5, AccessRMW, false},
+	0xc7: {"DCP", DCP, Zeropage, 5, AccessRMW, true},
+	0xc8: {"INY", INY, Implied, 2, AccessNone, false},
+	0xc9: {"CMP", CMP, Immidiate, 2, AccessRead, false},
+	0xca: {"DEX", DEX, Implied, 2, AccessNone, false},
+	0xcb: {"SBX", SBX, Immidiate, 2, AccessRead, true},
+	0xcc: {"CPY", CPY, Absolute, 4, AccessRead, false},
+	0xcd: {"CMP", CMP, Absolute, 4, AccessRead, false},
+	0xce: {"DEC", DEC, Absolute, 6, AccessRMW, false},
+	0xcf: {"DCP", DCP, Absolute, 6, AccessRMW, true},
+	0xd0: {"BNE", BNE, Relative, 2, AccessNone, false},
+	0xd1: {"CMP", CMP, IndirectIndexedY, 5, AccessRead, false},
+	0xd2: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0xd3: {"DCP", DCP, IndirectIndexedY, 8, AccessRMW, true},
+	0xd4: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0xd5: {"CMP", CMP, IndexedZeropageX, 4, AccessRead, false},
+	0xd6: {"DEC", DEC, IndexedZeropageX, 6, AccessRMW, false},
+	0xd7: {"DCP", DCP, IndexedZeropageX, 6, AccessRMW, true},
+	0xd8: {"CLD", CLD, Implied, 2, AccessNone, false},
+	0xd9: {"CMP", CMP, IndexedAbsoluteY, 4, AccessRead, false},
+	0xda: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0xdb: {"DCP", DCP, IndexedAbsoluteY, 7, AccessRMW, true},
+	0xdc: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0xdd: {"CMP", CMP, IndexedAbsoluteX, 4, AccessRead, false},
+	0xde: {"DEC", DEC, IndexedAbsoluteX, 7, AccessRMW, false},
+	0xdf: {"DCP", DCP, IndexedAbsoluteX, 7, AccessRMW, true},
+	0xe0: {"CPX", CPX, Immidiate, 2, AccessRead, false},
+	0xe1: {"SBC", SBC, IndexedIndirectX, 6, AccessRead, false},
+	0xe2: {"NOP", NOP, Immidiate, 2, AccessRead, true},
+	0xe3: {"ISC", ISC, IndexedIndirectX, 8, AccessRMW, true},
+	0xe4: {"CPX", CPX, Zeropage, 3, AccessRead, false},
+	0xe5: {"SBC", SBC, Zeropage, 3, AccessRead, false},
+	0xe6: {"INC", INC, Zeropage, 5, AccessRMW, false},
+	0xe7: {"ISC", ISC, Zeropage, 5, AccessRMW, true},
+	0xe8: {"INX", INX, Implied, 2, AccessNone, false},
+	0xe9: {"SBC", SBC, Immidiate, 2, AccessRead, false},
+	0xea: {"NOP", NOP, Implied, 2, AccessNone, false},
+	0xeb: {"SBC", SBC, Immidiate, 2, AccessRead, true},
+	0xec: {"CPX", CPX, Absolute, 4, AccessRead, false},
+	0xed: {"SBC", SBC, Absolute, 4, AccessRead, false},
+	0xee: {"INC", INC, Absolute, 6, AccessRMW, false},
+	0xef: {"ISC", ISC, Absolute, 6, AccessRMW, true},
+	0xf0: {"BEQ", BEQ, Relative, 2, AccessNone, false},
+	0xf1: {"SBC", SBC, IndirectIndexedY, 5, AccessRead, false},
+	0xf2: {"JAM", JAM, Implied, 0, AccessNone, true},
+	0xf3: {"ISC", ISC, IndirectIndexedY, 8, AccessRMW, true},
+	0xf4: {"NOP", NOP, IndexedZeropageX, 4, AccessRead, true},
+	0xf5: {"SBC", SBC, IndexedZeropageX, 4, AccessRead, false},
+	0xf6: {"INC", INC, IndexedZeropageX, 6, AccessRMW, false},
+	0xf7: {"ISC", ISC, IndexedZeropageX, 6, AccessRMW, true},
+	0xf8: {"SED", SED, Implied, 2, AccessNone, false},
+	0xf9: {"SBC", SBC, IndexedAbsoluteY, 4, AccessRead, false},
+	0xfa: {"NOP", NOP, Implied, 2, AccessNone, true},
+	0xfb: {"ISC", ISC, IndexedAbsoluteY, 7, AccessRMW, true},
+	0xfc: {"NOP", NOP, IndexedAbsoluteX, 4, AccessRead, true},
+	0xfd: {"SBC", SBC, IndexedAbsoluteX, 4, AccessRead, false},
+	0xfe: {"INC", INC, IndexedAbsoluteX, 7, AccessRMW, false},
+	0xff: {"ISC", ISC, IndexedAbsoluteX, 7, AccessRMW, true},
 }
 
 // BRK Force Break
@@ -190,7 +321,6 @@ var Instructions = map[byte]Instruction{
 // _ _ _ 1 _ _
 func BRK(cpu *CPU, mode AddressingMode) {
 	cpu.pc++
-	cpu.interrupt(true, IRQVector)
 }
 
 // ORA "OR" memory with accumulator
@@ -215,20 +345,12 @@ func ORA(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * * _ _ _
 func ASL(cpu *CPU, mode AddressingMode) {
-	asl := func(v uint8) uint8 {
-		cpu.setFlag(FlagC, (v&0x80) != 0)
-		v = v << 1
-		cpu.setFlag(FlagN, (v&0x80) != 0)
-		cpu.setFlag(FlagZ, v == 0)
-		return v
-	}
-
 	switch mode {
 	case Accumulator:
-		cpu.a = asl(cpu.a)
+		cpu.a = cpu.asl(cpu.a)
 	case Zeropage, Absolute, IndexedAbsoluteX, IndexedZeropageX:
-		v, addr := cpu.loadByte(mode)
-		cpu.mem.Write(addr, asl(v))
+		v, _ := cpu.loadByte(mode)
+		cpu.store(cpu.asl(v))
 	default:
 		cpu.logger.Error("unsupported addressing mode for ASL", "mode", mode)
 	}
@@ -248,10 +370,7 @@ func PHP(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BPL(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if !cpu.hasFlag(FlagN) {
-		cpu.pc = addr
-	}
+	cpu.branch(!cpu.hasFlag(FlagN))
 }
 
 // CLC Clear carry flag
@@ -270,9 +389,7 @@ func CLC(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func JSR(cpu *CPU, mode AddressingMode) {
-	addr := cpu.fetchWord()
-	cpu.push(uint8((((cpu.pc - 1) >> 8) & 0xff)))
-	cpu.push(uint8(((cpu.pc - 1) & 0xff)))
+	_, addr := cpu.loadByte(mode)
 	cpu.pc = addr
 }
 
@@ -313,25 +430,12 @@ func BIT(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * * _ _ _
 func ROL(cpu *CPU, mode AddressingMode) {
-	rol := func(v uint8) uint8 {
-		var c uint8 = 0
-		if cpu.hasFlag(FlagC) {
-			c = 1
-		}
-
-		cpu.setFlag(FlagC, (v&0x80) != 0)
-		v = (v << 1) | c
-		cpu.setFlag(FlagN, (v&0x80) != 0)
-		cpu.setFlag(FlagZ, v == 0)
-		return v
-	}
-
 	switch mode {
 	case Accumulator:
-		cpu.a = rol(cpu.a)
+		cpu.a = cpu.rol(cpu.a)
 	case Zeropage, Absolute, IndexedAbsoluteX, IndexedZeropageX:
-		v, addr := cpu.loadByte(mode)
-		cpu.mem.Write(addr, rol(v))
+		v, _ := cpu.loadByte(mode)
+		cpu.store(cpu.rol(v))
 	default:
 		cpu.logger.Error("unsupported addressing mode for ROL", "mode", mode)
 	}
@@ -350,10 +454,7 @@ func PLP(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BMI(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if cpu.hasFlag(FlagN) {
-		cpu.pc = addr
-	}
+	cpu.branch(cpu.hasFlag(FlagN))
 }
 
 // SEC Set carry flag
@@ -369,10 +470,8 @@ func SEC(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * * * * *
 func RTI(cpu *CPU, mode AddressingMode) {
-	cpu.p = cpu.pop()
-	pc := uint16(cpu.pop())
-	pc = uint16(cpu.pop())<<8 + pc
-	cpu.pc = pc
+	_, addr := cpu.loadByte(mode)
+	cpu.pc = addr
 }
 
 // EOR "Exclusive-Or" memory with accumulator
@@ -394,20 +493,12 @@ func EOR(cpu *CPU, mode AddressingMode) {
 //	N Z C I D V
 //	0 * * _ _ _
 func LSR(cpu *CPU, mode AddressingMode) {
-	lsr := func(v uint8) uint8 {
-		cpu.setFlag(FlagC, (v&0x01) != 0)
-		v = v >> 1
-		cpu.setFlag(FlagN, (v&0x80) != 0)
-		cpu.setFlag(FlagZ, v == 0)
-		return v
-	}
-
 	switch mode {
 	case Accumulator:
-		cpu.a = lsr(cpu.a)
+		cpu.a = cpu.lsr(cpu.a)
 	case Zeropage, Absolute, IndexedAbsoluteX, IndexedZeropageX:
-		v, addr := cpu.loadByte(mode)
-		cpu.mem.Write(addr, lsr(v))
+		v, _ := cpu.loadByte(mode)
+		cpu.store(cpu.lsr(v))
 	default:
 		cpu.logger.Error("unsupported addressing mode for LSR", "mode", mode)
 	}
@@ -443,10 +534,7 @@ func JMP(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BVC(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if !cpu.hasFlag(FlagV) {
-		cpu.pc = addr
-	}
+	cpu.branch(!cpu.hasFlag(FlagV))
 }
 
 // CLI Clear interrupt disable bit
@@ -463,9 +551,8 @@ func CLI(cpu *CPU, mode AddressingMode) {
 //	N Z C I D V
 //	_ _ _ _ _ _
 func RTS(cpu *CPU, mode AddressingMode) {
-	pc := uint16(cpu.pop())
-	pc = uint16(cpu.pop())<<8 + pc
-	cpu.pc = pc + 1
+	_, addr := cpu.loadByte(mode)
+	cpu.pc = addr + 1
 }
 
 // ADC Add memory to accumulator with carry
@@ -474,45 +561,7 @@ func RTS(cpu *CPU, mode AddressingMode) {
 // * * * _ _ *
 func ADC(cpu *CPU, mode AddressingMode) {
 	v, _ := cpu.loadByte(mode)
-	acc := uint16(cpu.a)
-	add := uint16(v)
-	var ans uint16 = 0
-	var carry uint16 = 0
-	if cpu.hasFlag(FlagC) {
-		carry = 1
-	}
-
-	if cpu.hasFlag(FlagD) {
-		// decimal mode
-		lo := (acc & 0x0f) + (add & 0x0f) + carry
-
-		var carrylo uint16
-		if lo >= 0x0a {
-			carrylo = 0x10
-			lo -= 0x0a
-		}
-
-		hi := (acc & 0xf0) + (add & 0xf0) + carrylo
-
-		if hi >= 0xa0 {
-			cpu.setFlag(FlagC, true)
-			hi -= 0xa0
-		} else {
-			cpu.setFlag(FlagC, false)
-		}
-
-		ans = hi | lo
-
-		cpu.setFlag(FlagV, ((acc^ans)&0x80) != 0 && ((acc^add)&0x80) == 0)
-	} else {
-		ans = acc + add + carry
-		cpu.setFlag(FlagC, ans > 0xff)
-		cpu.setFlag(FlagV, (((acc & 0x80) == (add & 0x80)) && ((acc & 0x80) != (ans & 0x80))))
-	}
-
-	cpu.a = uint8(ans)
-	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
-	cpu.setFlag(FlagZ, cpu.a == 0)
+	cpu.adc(v)
 }
 
 // ROR Rotate one bit right (memory or accumulator)
@@ -526,25 +575,12 @@ func ADC(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * * _ _ _
 func ROR(cpu *CPU, mode AddressingMode) {
-	ror := func(v uint8) uint8 {
-		var c uint8 = 0
-		if cpu.hasFlag(FlagC) {
-			c = 1
-		}
-
-		cpu.setFlag(FlagC, (v&0x01) != 0)
-		v = v>>1 | c<<7
-		cpu.setFlag(FlagN, (v&0x80) != 0)
-		cpu.setFlag(FlagZ, v == 0)
-		return v
-	}
-
 	switch mode {
 	case Accumulator:
-		cpu.a = ror(cpu.a)
+		cpu.a = cpu.ror(cpu.a)
 	case Zeropage, Absolute, IndexedAbsoluteX, IndexedZeropageX:
-		v, addr := cpu.loadByte(mode)
-		cpu.mem.Write(addr, ror(v))
+		v, _ := cpu.loadByte(mode)
+		cpu.store(cpu.ror(v))
 	default:
 		cpu.logger.Error("unsupported addressing mode for LSR", "mode", mode)
 	}
@@ -565,10 +601,7 @@ func PLA(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BVS(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if cpu.hasFlag(FlagV) {
-		cpu.pc = addr
-	}
+	cpu.branch(cpu.hasFlag(FlagV))
 }
 
 // SEI Set interrupt disable status
@@ -584,8 +617,7 @@ func SEI(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func STA(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	cpu.mem.Write(addr, cpu.a)
+	cpu.store(cpu.a)
 }
 
 // STY Store Index Y in memory
@@ -593,8 +625,7 @@ func STA(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func STY(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	cpu.mem.Write(addr, cpu.y)
+	cpu.store(cpu.y)
 }
 
 // STX Store Index X in memory
@@ -602,8 +633,7 @@ func STY(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func STX(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	cpu.mem.Write(addr, cpu.x)
+	cpu.store(cpu.x)
 }
 
 // DEY Decrement index Y by one
@@ -631,10 +661,7 @@ func TXA(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BCC(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if !cpu.hasFlag(FlagC) {
-		cpu.pc = addr
-	}
+	cpu.branch(!cpu.hasFlag(FlagC))
 }
 
 // TYA Transfer index Y to accumulator
@@ -710,10 +737,7 @@ func TAX(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BCS(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if cpu.hasFlag(FlagC) {
-		cpu.pc = addr
-	}
+	cpu.branch(cpu.hasFlag(FlagC))
 }
 
 // CLV Clear overflow flag
@@ -740,10 +764,7 @@ func TSX(cpu *CPU, mode AddressingMode) {
 // * * * _ _ _
 func CPY(cpu *CPU, mode AddressingMode) {
 	v, _ := cpu.loadByte(mode)
-	cpu.setFlag(FlagC, cpu.y >= v)
-	diff := cpu.y - v
-	cpu.setFlag(FlagN, (diff&0x80) != 0)
-	cpu.setFlag(FlagZ, diff == 0)
+	cpu.compare(cpu.y, v)
 }
 
 // CMP Compare memory and accumulator
@@ -752,10 +773,7 @@ func CPY(cpu *CPU, mode AddressingMode) {
 // * * * _ _ _
 func CMP(cpu *CPU, mode AddressingMode) {
 	v, _ := cpu.loadByte(mode)
-	cpu.setFlag(FlagC, cpu.a >= v)
-	diff := cpu.a - v
-	cpu.setFlag(FlagN, (diff&0x80) != 0)
-	cpu.setFlag(FlagZ, diff == 0)
+	cpu.compare(cpu.a, v)
 }
 
 // DEC Decrement Memory by one
@@ -763,9 +781,9 @@ func CMP(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * _ _ _ _
 func DEC(cpu *CPU, mode AddressingMode) {
-	v, addr := cpu.loadByte(mode)
+	v, _ := cpu.loadByte(mode)
 	v--
-	cpu.mem.Write(addr, v)
+	cpu.store(v)
 	cpu.setFlag(FlagN, (v&0x80) != 0)
 	cpu.setFlag(FlagZ, v == 0)
 }
@@ -795,10 +813,7 @@ func DEX(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BNE(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if !cpu.hasFlag(FlagZ) {
-		cpu.pc = addr
-	}
+	cpu.branch(!cpu.hasFlag(FlagZ))
 }
 
 // CLD Clear decimal mode
@@ -815,10 +830,7 @@ func CLD(cpu *CPU, mode AddressingMode) {
 // * * * _ _ _
 func CPX(cpu *CPU, mode AddressingMode) {
 	v, _ := cpu.loadByte(mode)
-	cpu.setFlag(FlagC, cpu.x >= v)
-	diff := cpu.x - v
-	cpu.setFlag(FlagN, (diff&0x80) != 0)
-	cpu.setFlag(FlagZ, diff == 0)
+	cpu.compare(cpu.x, v)
 }
 
 // SBC Subtract memory from accumulator with borrow
@@ -828,48 +840,7 @@ func CPX(cpu *CPU, mode AddressingMode) {
 // Note:C = Borrow
 func SBC(cpu *CPU, mode AddressingMode) {
 	v, _ := cpu.loadByte(mode)
-	acc := uint16(cpu.a)
-	sub := uint16(v)
-	var ans uint16 = 0
-	var carry uint16 = 0
-	if cpu.hasFlag(FlagC) {
-		carry = 1
-	}
-
-	if cpu.hasFlag(FlagD) {
-		lo := 0x0f + (acc & 0x0f) - (sub & 0x0f) + carry
-
-		var carrylo uint16
-		if lo < 0x10 {
-			lo -= 0x06
-			carrylo = 0
-		} else {
-			lo -= 0x10
-			carrylo = 0x10
-		}
-
-		hi := 0xf0 + (acc & 0xf0) - (sub & 0xf0) + carrylo
-
-		if hi < 0x100 {
-			cpu.setFlag(FlagC, false)
-			hi -= 0x60
-		} else {
-			cpu.setFlag(FlagC, true)
-			hi -= 0x100
-		}
-
-		ans = hi | lo
-
-		cpu.setFlag(FlagV, ((acc^ans)&0x80) != 0 && ((acc^sub)&0x80) != 0)
-	} else {
-		ans = 0xff + acc - sub + carry
-		cpu.setFlag(FlagC, ans > 0xff)
-		cpu.setFlag(FlagV, (((cpu.a & 0x80) != (v & 0x80)) && ((cpu.a & 0x80) != (uint8(ans) & 0x80))))
-	}
-
-	cpu.a = uint8(ans)
-	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
-	cpu.setFlag(FlagZ, cpu.a == 0)
+	cpu.sbc(v)
 }
 
 // INC Increment memory by one
@@ -877,9 +848,9 @@ func SBC(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // * * _ _ _ _
 func INC(cpu *CPU, mode AddressingMode) {
-	v, addr := cpu.loadByte(mode)
+	v, _ := cpu.loadByte(mode)
 	v++
-	cpu.mem.Write(addr, v)
+	cpu.store(v)
 	cpu.setFlag(FlagN, (v&0x80) != 0)
 	cpu.setFlag(FlagZ, v == 0)
 }
@@ -906,10 +877,7 @@ func NOP(cpu *CPU, mode AddressingMode) {
 // N Z C I D V
 // _ _ _ _ _ _
 func BEQ(cpu *CPU, mode AddressingMode) {
-	_, addr := cpu.loadByte(mode)
-	if cpu.hasFlag(FlagZ) {
-		cpu.pc = addr
-	}
+	cpu.branch(cpu.hasFlag(FlagZ))
 }
 
 // SED Set decimal mode
@@ -919,3 +887,382 @@ func BEQ(cpu *CPU, mode AddressingMode) {
 func SED(cpu *CPU, mode AddressingMode) {
 	cpu.setFlag(FlagD, true)
 }
+
+// Undocumented opcodes
+// https://www.masswerk.at/6502/6502_instruction_set.html#illegals
+
+// SLO Shift left one bit in memory, then OR accumulator with memory
+// Operation:  M = C <- [76543210] <- 0, A OR M -> A
+// N Z C I D V
+// * * * _ _ _
+func SLO(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v = cpu.asl(v)
+	cpu.store(v)
+	cpu.a |= v
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// RLA Rotate one bit left in memory, then AND accumulator with memory
+// Operation:  M = C <- [76543210] <- C, A AND M -> A
+// N Z C I D V
+// * * * _ _ _
+func RLA(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v = cpu.rol(v)
+	cpu.store(v)
+	cpu.a &= v
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// SRE Shift right one bit in memory, then EOR accumulator with memory
+// Operation:  M = 0 -> [76543210] -> C, A EOR M -> A
+// N Z C I D V
+// * * * _ _ _
+func SRE(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v = cpu.lsr(v)
+	cpu.store(v)
+	cpu.a ^= v
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// RRA Rotate one bit right in memory, then add memory to accumulator
+// Operation:  M = C -> [76543210] -> C, A + M + C -> A, C
+// N Z C I D V
+// * * * _ _ *
+func RRA(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v = cpu.ror(v)
+	cpu.store(v)
+	cpu.adc(v)
+}
+
+// SAX Store accumulator AND index X in memory
+// Operation:  A AND X -> M
+// N Z C I D V
+// _ _ _ _ _ _
+func SAX(cpu *CPU, mode AddressingMode) {
+	cpu.store(cpu.a & cpu.x)
+}
+
+// LAX Load accumulator and index X with memory
+// Operation:  M -> A -> X
+// N Z C I D V
+// * * _ _ _ _
+func LAX(cpu *CPU, mode AddressingMode) {
+	cpu.a, _ = cpu.loadByte(mode)
+	cpu.x = cpu.a
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// DCP Decrement memory by one, then compare with accumulator
+// Operation:  M - 1 -> M, A - M
+// N Z C I D V
+// * * * _ _ _
+func DCP(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v--
+	cpu.store(v)
+	cpu.compare(cpu.a, v)
+}
+
+// ISC Increment memory by one, then subtract memory from accumulator with borrow
+// Operation:  M + 1 -> M, A - M - C -> A
+// N Z C I D V
+// * * * _ _ *
+func ISC(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v++
+	cpu.store(v)
+	cpu.sbc(v)
+}
+
+// ANC AND memory with accumulator, then move bit 7 of the result into carry
+// Operation:  A AND M -> A, N -> C
+// N Z C I D V
+// * * * _ _ _
+func ANC(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	cpu.a &= v
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+	cpu.setFlag(FlagC, (cpu.a&0x80) != 0)
+}
+
+// ALR AND memory with accumulator, then shift right one bit
+// Operation:  A AND M -> A, 0 -> [76543210] -> C
+// N Z C I D V
+// 0 * * _ _ _
+func ALR(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	cpu.a = cpu.lsr(cpu.a & v)
+}
+
+// ARR AND memory with accumulator, then rotate one bit right
+// Operation:  A AND M -> A, C -> [76543210] -> C
+// C is bit 6 and V is bit 6 EOR bit 5 of the result. In decimal mode the
+// nibbles are fixed up afterwards and N, Z, V come from the binary result.
+// N Z C I D V
+// * * * _ _ *
+func ARR(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	t := cpu.a & v
+	var c uint8 = 0
+	if cpu.hasFlag(FlagC) {
+		c = 0x80
+	}
+	r := t>>1 | c
+	cpu.setFlag(FlagN, (r&0x80) != 0)
+	cpu.setFlag(FlagZ, r == 0)
+
+	if !cpu.hasFlag(FlagD) {
+		cpu.a = r
+		cpu.setFlag(FlagC, (r&0x40) != 0)
+		cpu.setFlag(FlagV, ((r>>6)^(r>>5))&0x01 != 0)
+		return
+	}
+
+	cpu.setFlag(FlagV, ((t^r)&0x40) != 0)
+	if (t&0x0f)+(t&0x01) > 0x05 {
+		r = r&0xf0 | (r+0x06)&0x0f
+	}
+	hi := t >> 4
+	cpu.setFlag(FlagC, hi+(hi&0x01) > 0x05)
+	if cpu.hasFlag(FlagC) {
+		r += 0x60
+	}
+	cpu.a = r
+}
+
+// SBX AND accumulator with index X, then subtract memory without borrow
+// Operation:  (A AND X) - M -> X
+// N Z C I D V
+// * * * _ _ _
+func SBX(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	ax := cpu.a & cpu.x
+	cpu.compare(ax, v)
+	cpu.x = ax - v
+}
+
+// ANE OR accumulator with a chip dependent constant, then AND with index X
+// and memory, unstable
+// Operation:  (A OR CONST) AND X AND M -> A
+// N Z C I D V
+// * * _ _ _ _
+func ANE(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	cpu.a = (cpu.a | unstableConst) & cpu.x & v
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// LXA OR accumulator with a chip dependent constant, then AND with memory
+// and load index X, unstable
+// Operation:  (A OR CONST) AND M -> A -> X
+// N Z C I D V
+// * * _ _ _ _
+func LXA(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	cpu.a = (cpu.a | unstableConst) & v
+	cpu.x = cpu.a
+	cpu.setFlag(FlagN, (cpu.a&0x80) != 0)
+	cpu.setFlag(FlagZ, cpu.a == 0)
+}
+
+// SHA Store accumulator AND index X AND high address byte + 1, unstable
+// Operation:  A AND X AND (H + 1) -> M
+// N Z C I D V
+// _ _ _ _ _ _
+func SHA(cpu *CPU, mode AddressingMode) {
+	cpu.storeHigh(cpu.a & cpu.x)
+}
+
+// SHX Store index X AND high address byte + 1, unstable
+// Operation:  X AND (H + 1) -> M
+// N Z C I D V
+// _ _ _ _ _ _
+func SHX(cpu *CPU, mode AddressingMode) {
+	cpu.storeHigh(cpu.x)
+}
+
+// SHY Store index Y AND high address byte + 1, unstable
+// Operation:  Y AND (H + 1) -> M
+// N Z C I D V
+// _ _ _ _ _ _
+func SHY(cpu *CPU, mode AddressingMode) {
+	cpu.storeHigh(cpu.y)
+}
+
+// TAS Transfer accumulator AND index X to stack pointer, then store it
+// AND high address byte + 1, unstable
+// Operation:  A AND X -> S, S AND (H + 1) -> M
+// N Z C I D V
+// _ _ _ _ _ _
+func TAS(cpu *CPU, mode AddressingMode) {
+	cpu.sp = cpu.a & cpu.x
+	cpu.storeHigh(cpu.sp)
+}
+
+// LAS AND memory with stack pointer, then load accumulator, index X and
+// stack pointer
+// Operation:  M AND S -> A, X, S
+// N Z C I D V
+// * * _ _ _ _
+func LAS(cpu *CPU, mode AddressingMode) {
+	v, _ := cpu.loadByte(mode)
+	v &= cpu.sp
+	cpu.a, cpu.x, cpu.sp = v, v, v
+	cpu.setFlag(FlagN, (v&0x80) != 0)
+	cpu.setFlag(FlagZ, v == 0)
+}
+
+// JAM Halt the CPU, only a reset recovers it
+// Operation:  Stop
+// N Z C I D V
+// _ _ _ _ _ _
+func JAM(cpu *CPU, mode AddressingMode) {
+	cpu.jam(cpu.opcode)
+}
+
+func (cpu *CPU) asl(v uint8) uint8 {
+	cpu.setFlag(FlagC, (v&0x80) != 0)
+	v = v << 1
+	cpu.setFlag(FlagN, (v&0x80) != 0)
+	cpu.setFlag(FlagZ, v == 0)
+	return v
+}
+
+func (cpu *CPU) rol(v uint8) uint8 {
+	var c uint8 = 0
+	if cpu.hasFlag(FlagC) {
+		c = 1
+	}
+
+	cpu.setFlag(FlagC, (v&0x80) != 0)
+	v = (v << 1) | c
+	cpu.setFlag(FlagN, (v&0x80) != 0)
+	cpu.setFlag(FlagZ, v == 0)
+	return v
+}
+
+func (cpu *CPU) lsr(v uint8) uint8 {
+	cpu.setFlag(FlagC, (v&0x01) != 0)
+	v = v >> 1
+	cpu.setFlag(FlagN, (v&0x80) != 0)
+	cpu.setFlag(FlagZ, v == 0)
+	return v
+}
+
+func (cpu *CPU) ror(v uint8) uint8 {
+	var c uint8 = 0
+	if cpu.hasFlag(FlagC) {
+		c = 1
+	}
+
+	cpu.setFlag(FlagC, (v&0x01) != 0)
+	v = v>>1 | c<<7
+	cpu.setFlag(FlagN, (v&0x80) != 0)
+	cpu.setFlag(FlagZ, v == 0)
+	return v
+}
+
+// adc and sbc follow the NMOS 6502 in decimal mode, including invalid BCD
+// inputs. Z is always set from the binary result, so are N, V and C for SBC.
+// ADC sets N and V from the sum after the low nibble is adjusted, and C from
+// the decimal result.
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func (cpu *CPU) adc(v uint8) {
+	acc := uint16(cpu.a)
+	add := uint16(v)
+	var carry uint16 = 0
+	if cpu.hasFlag(FlagC) {
+		carry = 1
+	}
+
+	ans := acc + add + carry
+	cpu.setFlag(FlagZ, uint8(ans) == 0)
+	if !cpu.hasFlag(FlagD) {
+		cpu.setFlag(FlagC, ans > 0xff)
+		cpu.setFlag(FlagV, (((acc & 0x80) == (add & 0x80)) && ((acc & 0x80) != (ans & 0x80))))
+		cpu.setFlag(FlagN, (ans&0x80) != 0)
+		cpu.a = uint8(ans)
+		return
+	}
+
+	lo := (acc & 0x0f) + (add & 0x0f) + carry
+	if lo >= 0x0a {
+		lo = ((lo + 0x06) & 0x0f) + 0x10
+	}
+	ans = (acc & 0xf0) + (add & 0xf0) + lo
+	signed := int(int8(acc&0xf0)) + int(int8(add&0xf0)) + int(lo)
+	cpu.setFlag(FlagN, (ans&0x80) != 0)
+	cpu.setFlag(FlagV, signed < -128 || signed > 127)
+	if ans >= 0xa0 {
+		ans += 0x60
+	}
+	cpu.setFlag(FlagC, ans > 0xff)
+	cpu.a = uint8(ans)
+}
+
+func (cpu *CPU) sbc(v uint8) {
+	acc := uint16(cpu.a)
+	sub := uint16(v)
+	var carry uint16 = 0
+	if cpu.hasFlag(FlagC) {
+		carry = 1
+	}
+
+	ans := 0xff + acc - sub + carry
+	cpu.setFlag(FlagC, ans > 0xff)
+	cpu.setFlag(FlagV, (((acc & 0x80) != (sub & 0x80)) && ((acc & 0x80) != (ans & 0x80))))
+	cpu.setFlag(FlagN, (ans&0x80) != 0)
+	cpu.setFlag(FlagZ, uint8(ans) == 0)
+	if !cpu.hasFlag(FlagD) {
+		cpu.a = uint8(ans)
+		return
+	}
+
+	lo := int(acc&0x0f) - int(sub&0x0f) + int(carry) - 1
+	if lo < 0 {
+		lo = ((lo - 0x06) & 0x0f) - 0x10
+	}
+	dec := int(acc&0xf0) - int(sub&0xf0) + lo
+	if dec < 0 {
+		dec -= 0x60
+	}
+	cpu.a = uint8(dec)
+}
+
+func (cpu *CPU) compare(reg, v uint8) {
+	cpu.setFlag(FlagC, reg >= v)
+	diff := reg - v
+	cpu.setFlag(FlagN, (diff&0x80) != 0)
+	cpu.setFlag(FlagZ, diff == 0)
+}
+
+// storeHigh stores v AND (H + 1) for SHA, SHX, SHY and TAS, H being the high
+// byte of the base address. When indexing crosses a page the stored value
+// also replaces the high byte of the target address.
+func (cpu *CPU) storeHigh(v uint8) {
+	v &= uint8(cpu.base>>8) + 1
+	if cpu.base&0xff00 != cpu.addr&0xff00 {
+		cpu.addr = uint16(v)<<8 | cpu.addr&0x00ff
+	}
+	cpu.store(v)
+}
+
+// branch ends the instruction unless cond holds, otherwise it sets the
+// target for the cycles that take the branch.
+func (cpu *CPU) branch(cond bool) {
+	if !cond {
+		cpu.finish()
+		return
+	}
+	cpu.addr = cpu.pc + uint16(int8(cpu.data)) // offset could be nagative
+}
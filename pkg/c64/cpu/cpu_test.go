@@ -1,10 +1,14 @@
 package cpu
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"testing"
+	"time"
 
-	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/irq"
 	"github.com/jejer/commando64/pkg/c64/memory"
 )
 
@@ -16,9 +20,8 @@ func TestCPU(t *testing.T) {
 	// logger := slog.New(handler)
 	logger := slog.Default()
 	mem := memory.NewC64Memory(*logger, nil, nil, nil)
-	irqCh := make(chan bool)
-	clock := clock.NewClock()
-	cpu := NewCPU(*logger, clock, mem, irqCh)
+	cpu := NewCPU(*logger, mem, irq.NewController())
+	mem.Write(0x00, 0x07)
 	mem.Write(0x01, 0x0) // umount c64 roms
 	mem.LoadRom("../../../test/roms/6502_functional_test.bin", 0x400, true)
 	cpu.pc = 0x400
@@ -39,9 +42,9 @@ func TestCPU(t *testing.T) {
 	// 	<-time.After(time.Duration(time.Millisecond))
 	// }
 	for i := uint64(0); ; i++ {
-		t.Logf("pc: %04x", pc)
 		if pc == cpu.pc {
-			t.Errorf("CPU test failed at 0x%x", pc)
+			// the test traps failures in a jump to itself
+			t.Errorf("CPU test failed at 0x%x after %d instructions: %+v", pc, i, cpu.State())
 			break
 		}
 		if cpu.pc == 0x3463 {
@@ -52,3 +55,246 @@ func TestCPU(t *testing.T) {
 		cpu.step()
 	}
 }
+
+// Tick returns when an IRQ is asserted right after SEI.
+func TestIRQAfterSEI(t *testing.T) {
+	logger := slog.Default()
+	mem := memory.NewC64Memory(*logger, nil, nil, nil)
+	ctrl := irq.NewController()
+	cpu := NewCPU(*logger, mem, ctrl)
+	mem.Write(0x00, 0x07)
+	mem.Write(0x01, 0x0)                                          // umount c64 roms
+	mem.LoadRomData([]byte{0x78, 0xea, 0xea, 0xea}, 0xc000, true) // sei, nop
+	mem.LoadRomData([]byte{0x00, 0xc1}, IRQVector, true)
+	mem.LoadRomData([]byte{0xea, 0xea, 0xea, 0xea}, 0xc100, true)
+	cpu.pc = 0xc000
+
+	for cpu.pc == 0xc000 {
+		cpu.Tick() // sei
+	}
+	ctrl.SetIRQ(irq.SourceCIA1, true)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			cpu.Tick()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Tick hangs on an IRQ after SEI")
+	}
+	if !cpu.hasFlag(FlagI) {
+		t.Errorf("I flag clear, P=%08b", cpu.p)
+	}
+}
+
+func TestUndocumentedOpcodes(t *testing.T) {
+	for op, inst := range Instructions {
+		if inst.fn == nil {
+			t.Errorf("opcode %02x missing", op)
+		}
+	}
+
+	mem := memory.NewC64Memory(*slog.Default(), nil, nil, nil)
+	mem.Write(0x00, 0x07)
+	mem.Write(0x01, 0x0) // umount c64 roms
+	cpu := NewCPU(*slog.Default(), mem, irq.NewController())
+	for _, tc := range []struct {
+		name    string
+		code    []byte
+		a, x, p uint8 // expected registers
+		m       uint8 // expected $10
+	}{
+		{"LAX", []byte{0xa7, 0x10}, 0x80, 0x80, FlagN, 0x80},
+		{"SAX", []byte{0x87, 0x10}, 0x0f, 0x3c, 0, 0x0c},
+		{"DCP", []byte{0xc7, 0x10}, 0x0f, 0x3c, FlagN, 0x7f},
+		{"ISC", []byte{0xe7, 0x10}, 0x8d, 0x3c, FlagN | FlagV, 0x81},
+		{"SLO", []byte{0x07, 0x10}, 0x0f, 0x3c, FlagC, 0x00},
+		{"ANC", []byte{0x0b, 0x80}, 0x00, 0x3c, FlagZ, 0x80},
+		{"SBX", []byte{0xcb, 0x02}, 0x0f, 0x0a, FlagC, 0x80},
+		{"ARR", []byte{0x6b, 0xff}, 0x07, 0x3c, 0, 0x80},
+		{"NOP abs", []byte{0x0c, 0x10, 0x00}, 0x0f, 0x3c, 0, 0x80},
+	} {
+		for i, b := range tc.code {
+			mem.Write(0x1000+uint16(i), b)
+		}
+		mem.Write(0x10, 0x80)
+		cpu.SetState(State{PC: 0x1000, A: 0x0f, X: 0x3c, P: FlagConstant, SP: 0xff})
+		cpu.step()
+		s := cpu.State()
+		if s.A != tc.a || s.X != tc.x || s.P != tc.p|FlagConstant || mem.Read(0x10) != tc.m || s.PC != 0x1000+uint16(len(tc.code)) {
+			t.Errorf("%s: A=%02x X=%02x P=%08b M=%02x PC=%04x, want A=%02x X=%02x P=%08b M=%02x",
+				tc.name, s.A, s.X, s.P, mem.Read(0x10), s.PC, tc.a, tc.x, tc.p|FlagConstant, tc.m)
+		}
+	}
+
+	mem.Write(0x1000, 0x02)
+	cpu.SetState(State{PC: 0x1000, A: 0x42, P: FlagConstant, SP: 0xff})
+	cpu.step()
+	var jam *JamError
+	if !errors.As(cpu.Err(), &jam) || jam.Opcode != 0x02 || jam.State.PC != 0x1000 || jam.State.A != 0x42 {
+		t.Errorf("JAM: err = %v", cpu.Err())
+	}
+	cpu.step()
+	if !cpu.Halted() || cpu.State().PC != 0x1000 {
+		t.Errorf("JAM: halted = %v, PC = %04x", cpu.Halted(), cpu.State().PC)
+	}
+	jammed := cpu.State()
+	cpu.Reset()
+	if cpu.Halted() {
+		t.Error("JAM: still halted after reset")
+	}
+	cpu.SetState(jammed)
+	if !errors.As(cpu.Err(), &jam) || jam.Opcode != 0x02 || jam.State.PC != 0x1000 {
+		t.Errorf("JAM: restored err = %v", cpu.Err())
+	}
+
+	// a CPU held by RDY restores held
+	cpu.SetState(State{PC: 0x1000, P: FlagConstant, SP: 0xff})
+	cpu.SetRDY(false)
+	held := cpu.State()
+	cpu.SetRDY(true)
+	cpu.SetState(held)
+	cpu.Tick()
+	if s := cpu.State(); s.PC != 0x1000 || !s.RDYLow {
+		t.Errorf("RDY: PC = %04x, RDY low = %v after restore", s.PC, s.RDYLow)
+	}
+}
+
+// NMOS 6510 cycles per opcode without penalties, JAM as 0
+var referenceCycles = [256]uint8{
+	// 0 1 2  3  4  5  6  7  8  9  a  b  c  d  e  f
+	7, 6, 0, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6, // 0
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 1
+	6, 6, 0, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6, // 2
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 3
+	6, 6, 0, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6, // 4
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 5
+	6, 6, 0, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6, // 6
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 7
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // 8
+	2, 6, 0, 6, 4, 4, 4, 4, 2, 5, 2, 5, 5, 5, 5, 5, // 9
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // a
+	2, 5, 0, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4, // b
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // c
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // d
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // e
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // f
+}
+
+func TestCycles(t *testing.T) {
+	for op, want := range referenceCycles {
+		inst := Instructions[byte(op)]
+		if got := inst.cycles; got != want {
+			t.Errorf("opcode %02x: %d cycles, want %d", op, got, want)
+		}
+		// one cycle per micro-op after the opcode fetch, indexed reads and
+		// branches have optional cycles at the end
+		got := uint8(len(programs[op]) + 1)
+		switch {
+		case inst.mode == Relative:
+			got -= 2
+		case inst.access == AccessRead && (inst.mode == IndexedAbsoluteX || inst.mode == IndexedAbsoluteY || inst.mode == IndirectIndexedY):
+			got--
+		case want == 0: // JAM
+			continue
+		}
+		if got != want {
+			t.Errorf("opcode %02x: %d cycles programmed, want %d", op, got, want)
+		}
+	}
+
+	mem := memory.NewC64Memory(*slog.Default(), nil, nil, nil)
+	mem.Write(0x00, 0x07)
+	mem.Write(0x01, 0x0) // umount c64 roms
+	mem.Write(0x20, 0xf0)
+	mem.Write(0x21, 0x12) // ($20) = $12f0
+	cpu := NewCPU(*slog.Default(), mem, irq.NewController())
+	for _, tc := range []struct {
+		name   string
+		pc     uint16
+		code   []byte
+		p      uint8
+		cycles int
+	}{
+		{"LDA abs,X", 0x1000, []byte{0xbd, 0x00, 0x12}, 0, 4},
+		{"LDA abs,X page crossed", 0x1000, []byte{0xbd, 0xf0, 0x12}, 0, 5},
+		{"LDX abs,Y page crossed", 0x1000, []byte{0xbe, 0xf0, 0x12}, 0, 5},
+		{"LDA (zp),Y page crossed", 0x1000, []byte{0xb1, 0x20}, 0, 6},
+		{"LAX (zp),Y page crossed", 0x1000, []byte{0xb3, 0x20}, 0, 6},
+		{"NOP abs,X page crossed", 0x1000, []byte{0xfc, 0xf0, 0x12}, 0, 5},
+		{"STA abs,X page crossed", 0x1000, []byte{0x9d, 0xf0, 0x12}, 0, 5},
+		{"STA (zp),Y page crossed", 0x1000, []byte{0x91, 0x20}, 0, 6},
+		{"INC abs,X page crossed", 0x1000, []byte{0xfe, 0xf0, 0x12}, 0, 7},
+		{"LDA zp,X wraps", 0x1000, []byte{0xb5, 0xf0}, 0, 4},
+		{"BNE not taken", 0x1000, []byte{0xd0, 0x10}, FlagZ, 2},
+		{"BNE taken", 0x1000, []byte{0xd0, 0x10}, 0, 3},
+		{"BNE taken backwards", 0x1080, []byte{0xd0, 0x80}, 0, 3},
+		{"BNE taken page crossed", 0x10f0, []byte{0xd0, 0x10}, 0, 4},
+		{"BNE taken backwards page crossed", 0x1000, []byte{0xd0, 0xf0}, 0, 4},
+	} {
+		for i, b := range tc.code {
+			mem.Write(tc.pc+uint16(i), b)
+		}
+		cpu.SetState(State{PC: tc.pc, X: 0x20, Y: 0x20, P: FlagConstant | tc.p, SP: 0xff})
+		if cycles := cpu.step(); cycles != tc.cycles {
+			t.Errorf("%s: %d cycles, want %d", tc.name, cycles, tc.cycles)
+		}
+	}
+}
+
+func TestBusAccesses(t *testing.T) {
+	b := &bus{}
+	copy(b.mem[0x1000:], []byte{0xfe, 0xf0, 0x12}) // INC $12f0,X
+	b.mem[0x1310] = 0x41
+	cpu := NewCPU(*slog.Default(), b, irq.NewController())
+	cpu.SetState(State{PC: 0x1000, X: 0x20, P: FlagConstant, SP: 0xff})
+
+	// RDY low halts the reads but not the double write
+	for i := 0; i < 5; i++ {
+		cpu.Tick()
+	}
+	cpu.SetRDY(false)
+	for i := 0; i < 4; i++ {
+		cpu.Tick()
+	}
+	want := []busCycle{
+		{0x1000, 0xfe, "read"}, {0x1001, 0xf0, "read"}, {0x1002, 0x12, "read"},
+		{0x1210, 0x00, "read"}, // address before the carry into the high byte
+		{0x1310, 0x41, "read"},
+		{0x1310, 0x41, "write"}, {0x1310, 0x42, "write"},
+	}
+	if fmt.Sprint(b.log) != fmt.Sprint(want) {
+		t.Errorf("bus accesses %v, want %v", b.log, want)
+	}
+	cpu.SetRDY(true)
+	cpu.Tick()
+	if len(b.log) != len(want)+1 || cpu.State().PC != 0x1004 {
+		t.Errorf("no opcode fetch after RDY: %v", b.log[len(want):])
+	}
+}
+
+// BenchmarkCPUStep runs the functional test instruction by instruction on a
+// bare CPU, the MHz are emulated cycles per second.
+func BenchmarkCPUStep(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mem := memory.NewC64Memory(*logger, nil, nil, nil)
+	cpu := NewCPU(*logger, mem, irq.NewController())
+	mem.Write(0x00, 0x07)
+	mem.Write(0x01, 0x0) // umount c64 roms
+	if err := mem.LoadRom("../../../test/roms/6502_functional_test.bin", 0x400, true); err != nil {
+		b.Fatal(err)
+	}
+	cpu.pc = 0x400
+	b.ResetTimer()
+	cycles := 0
+	for i := 0; i < b.N; i++ {
+		if cpu.pc == 0x3463 {
+			cpu.pc = 0x400
+		}
+		cycles += cpu.step()
+	}
+	b.ReportMetric(float64(cycles)/b.Elapsed().Seconds()/1e6, "MHz")
+}
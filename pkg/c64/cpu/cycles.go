@@ -0,0 +1,332 @@
+package cpu
+
+// The 6510 accesses the bus on every cycle, including dummy reads and the
+// double write of read-modify-write instructions. Each instruction is a
+// program of micro-ops, one per cycle after the opcode fetch, following
+// "64doc" (http://www.atarihq.com/danb/files/64doc.txt).
+// The instruction functions run on the cycle the operation takes effect,
+// loadByte returns the operand fetched by the cycles before and store sets
+// the value written by the cycles after.
+
+type microOp struct {
+	fn    func(cpu *CPU)
+	write bool // write cycles are not halted by RDY
+	dummy bool // the value read is discarded
+}
+
+// sequences run by the CPU, the zero value is no sequence in progress
+const (
+	seqNone uint8 = iota
+	seqInstruction
+	seqIRQ
+	seqNMI
+	seqReset
+)
+
+var (
+	programs [256][]microOp
+
+	// cycles 2-7 of IRQ and NMI, cycle 1 is the discarded opcode fetch
+	interruptProgram = append([]microOp{dummy(dummyReadPC)}, interruptTail...)
+	// cycles 3-7 of BRK, IRQ and NMI
+	interruptTail = []microOp{
+		write(pushPCH),
+		write(pushPCL),
+		write(pushP),
+		read(fetchVectorLo),
+		read(fetchVectorHi),
+	}
+	// reset runs the interrupt cycles with the writes turned into reads
+	resetProgram = []microOp{
+		dummy(dummyReadPC),
+		dummy(dummyReadPC),
+		dummy(dummyPull),
+		dummy(dummyPull),
+		dummy(dummyPull),
+		read(fetchVectorLo),
+		read(fetchVectorHi),
+	}
+)
+
+func init() {
+	for op, inst := range Instructions {
+		programs[op] = program(byte(op), inst)
+	}
+}
+
+func read(fn func(cpu *CPU)) microOp {
+	return microOp{fn: fn}
+}
+
+func write(fn func(cpu *CPU)) microOp {
+	return microOp{fn: fn, write: true}
+}
+
+func dummy(fn func(cpu *CPU)) microOp {
+	return microOp{fn: fn, dummy: true}
+}
+
+func program(op byte, inst Instruction) []microOp {
+	switch op {
+	case 0x00: // BRK
+		return append([]microOp{dummy(execute(dummyReadPC))}, interruptTail...)
+	case 0x20: // JSR
+		return []microOp{read(fetchAddrLo), dummy(dummyReadStack), write(pushPCH), write(pushPCL), read(execute(fetchAddrHi))}
+	case 0x40: // RTI
+		return []microOp{dummy(dummyReadPC), dummy(dummyReadStack), read(pullP), read(pullAddrLo), read(execute(pullAddrHi))}
+	case 0x60: // RTS
+		return []microOp{dummy(dummyReadPC), dummy(dummyReadStack), read(pullAddrLo), read(pullAddrHi), dummy(execute(dummyReadAddr))}
+	case 0x08, 0x48: // PHP, PHA
+		return []microOp{dummy(dummyReadPC), write(execute(nothing))}
+	case 0x28, 0x68: // PLP, PLA
+		return []microOp{dummy(dummyReadPC), dummy(dummyReadStack), read(execute(nothing))}
+	case 0x4c: // JMP abs
+		return []microOp{read(fetchAddrLo), read(execute(fetchAddrHi))}
+	case 0x6c: // JMP (ind)
+		return []microOp{read(fetchAddrLo), read(fetchAddrHi), read(readPointerLo), read(execute(readPointerHi))}
+	}
+
+	switch inst.mode {
+	case Implied, Accumulator:
+		return []microOp{dummy(execute(dummyReadPC))}
+	case Immidiate:
+		return []microOp{read(execute(fetchData))}
+	case Relative:
+		return []microOp{read(execute(fetchData)), dummy(branchTaken), dummy(branchPageCrossed)}
+	case Zeropage:
+		return append([]microOp{read(fetchAddrLo)}, operand(inst.access)...)
+	case IndexedZeropageX:
+		return append([]microOp{read(fetchAddrLo), dummy(zeropageIndexed(indexX))}, operand(inst.access)...)
+	case IndexedZeropageY:
+		return append([]microOp{read(fetchAddrLo), dummy(zeropageIndexed(indexY))}, operand(inst.access)...)
+	case Absolute:
+		return append([]microOp{read(fetchAddrLo), read(fetchAddrHi)}, operand(inst.access)...)
+	case IndexedAbsoluteX:
+		return append([]microOp{read(fetchAddrLo), read(fetchAddrHiIndexed(indexX))}, indexedOperand(inst.access, indexX)...)
+	case IndexedAbsoluteY:
+		return append([]microOp{read(fetchAddrLo), read(fetchAddrHiIndexed(indexY))}, indexedOperand(inst.access, indexY)...)
+	case IndexedIndirectX:
+		return append([]microOp{read(fetchPointer), dummy(pointerIndexedX), read(readPointerLo), read(readPointerHi)}, operand(inst.access)...)
+	case IndirectIndexedY:
+		return append([]microOp{read(fetchPointer), read(readPointerLo), read(readPointerHiIndexedY)}, indexedOperand(inst.access, indexY)...)
+	}
+	return nil
+}
+
+// operand returns the cycles accessing the effective address.
+func operand(access Access) []microOp {
+	switch access {
+	case AccessWrite:
+		return []microOp{write(executeStore)}
+	case AccessRMW:
+		// the unmodified value is written back while the new one is computed
+		return []microOp{read(readData), write(execute(storeData)), write(storeData)}
+	}
+	return []microOp{read(execute(readData))}
+}
+
+// indexedOperand returns the cycles accessing an indexed effective address.
+// The first read uses the address before the carry into the high byte is
+// added, reads finish there if the index did not cross a page.
+func indexedOperand(access Access, index func(cpu *CPU) uint8) []microOp {
+	if access == AccessRead {
+		return []microOp{read(func(cpu *CPU) {
+			fixed := cpu.base + uint16(index(cpu))
+			cpu.dummyRead = fixed != cpu.addr
+			v := cpu.mem.Read(cpu.addr)
+			if cpu.dummyRead {
+				cpu.addr = fixed
+				return
+			}
+			cpu.data = v
+			cpu.execute()
+			cpu.finish()
+		}), read(execute(readData))}
+	}
+	return append([]microOp{dummy(func(cpu *CPU) {
+		cpu.mem.Read(cpu.addr)
+		cpu.addr = cpu.base + uint16(index(cpu))
+	})}, operand(access)...)
+}
+
+// execute runs the instruction function after the bus access of fn.
+func execute(fn func(cpu *CPU)) func(cpu *CPU) {
+	return func(cpu *CPU) {
+		fn(cpu)
+		cpu.execute()
+	}
+}
+
+// executeStore runs the instruction function, then writes what it stored.
+func executeStore(cpu *CPU) {
+	cpu.execute()
+	storeData(cpu)
+}
+
+func (cpu *CPU) execute() {
+	cpu.inst.fn(cpu, cpu.inst.mode)
+}
+
+// finish ends the current instruction early, e.g. a branch not taken.
+func (cpu *CPU) finish() {
+	cpu.pos = len(cpu.program)
+}
+
+func indexX(cpu *CPU) uint8 { return cpu.x }
+func indexY(cpu *CPU) uint8 { return cpu.y }
+
+func nothing(cpu *CPU) {}
+
+func dummyReadPC(cpu *CPU) {
+	cpu.mem.Read(cpu.pc)
+}
+
+func dummyReadAddr(cpu *CPU) {
+	cpu.mem.Read(cpu.addr)
+}
+
+func dummyReadStack(cpu *CPU) {
+	cpu.mem.Read(StackLow + uint16(cpu.sp))
+}
+
+func dummyPull(cpu *CPU) {
+	cpu.mem.Read(StackLow + uint16(cpu.sp))
+	cpu.sp--
+}
+
+func fetchData(cpu *CPU) {
+	cpu.data = cpu.fetchOP()
+}
+
+func fetchAddrLo(cpu *CPU) {
+	cpu.addr = uint16(cpu.fetchOP())
+}
+
+func fetchAddrHi(cpu *CPU) {
+	cpu.addr |= uint16(cpu.mem.Read(cpu.pc)) << 8
+	cpu.pc++
+}
+
+func fetchAddrHiIndexed(index func(cpu *CPU) uint8) func(cpu *CPU) {
+	return func(cpu *CPU) {
+		fetchAddrHi(cpu)
+		cpu.base = cpu.addr
+		cpu.addr = cpu.base&0xff00 | uint16(uint8(cpu.base)+index(cpu))
+	}
+}
+
+func zeropageIndexed(index func(cpu *CPU) uint8) func(cpu *CPU) {
+	return func(cpu *CPU) {
+		cpu.mem.Read(cpu.addr)
+		cpu.addr = uint16(uint8(cpu.addr) + index(cpu))
+	}
+}
+
+func fetchPointer(cpu *CPU) {
+	cpu.ptr = cpu.fetchOP()
+}
+
+func pointerIndexedX(cpu *CPU) {
+	cpu.mem.Read(uint16(cpu.ptr))
+	cpu.ptr += cpu.x
+}
+
+// readPointerLo reads the low byte of the address at ptr, or at addr for
+// JMP (ind).
+func readPointerLo(cpu *CPU) {
+	if cpu.inst.mode == AbsoluteIndirect {
+		cpu.base = cpu.addr
+		cpu.addr = uint16(cpu.mem.Read(cpu.base))
+		return
+	}
+	cpu.addr = uint16(cpu.mem.Read(uint16(cpu.ptr)))
+}
+
+// readPointerHi reads the high byte of the address, the pointer wraps
+// around within its page.
+func readPointerHi(cpu *CPU) {
+	if cpu.inst.mode == AbsoluteIndirect {
+		cpu.addr |= uint16(cpu.mem.Read(cpu.base&0xff00|uint16(uint8(cpu.base)+1))) << 8
+		return
+	}
+	cpu.addr |= uint16(cpu.mem.Read(uint16(cpu.ptr+1))) << 8
+}
+
+func readPointerHiIndexedY(cpu *CPU) {
+	readPointerHi(cpu)
+	cpu.base = cpu.addr
+	cpu.addr = cpu.base&0xff00 | uint16(uint8(cpu.base)+cpu.y)
+}
+
+func readData(cpu *CPU) {
+	cpu.data = cpu.mem.Read(cpu.addr)
+}
+
+func storeData(cpu *CPU) {
+	cpu.mem.Write(cpu.addr, cpu.data)
+}
+
+// branchTaken runs when the branch is taken, the low byte of PC is
+// replaced first and the high byte fixed in another cycle if needed.
+func branchTaken(cpu *CPU) {
+	cpu.mem.Read(cpu.pc)
+	pc := cpu.pc&0xff00 | cpu.addr&0x00ff
+	if pc == cpu.addr {
+		cpu.finish()
+	}
+	cpu.pc = pc
+}
+
+func branchPageCrossed(cpu *CPU) {
+	cpu.mem.Read(cpu.pc)
+	cpu.pc = cpu.addr
+}
+
+func pushPCH(cpu *CPU) {
+	cpu.push(uint8(cpu.pc >> 8))
+}
+
+func pushPCL(cpu *CPU) {
+	cpu.push(uint8(cpu.pc))
+}
+
+// pushP pushes the status with B set for BRK, and selects the vector. An NMI
+// arriving before the vector is fetched hijacks BRK and IRQ.
+func pushP(cpu *CPU) {
+	switch {
+	case cpu.sequence == seqNMI || cpu.irq.TakeNMI():
+		cpu.addr = NMIVector
+	default:
+		cpu.addr = IRQVector
+	}
+	if cpu.sequence == seqInstruction {
+		cpu.push(cpu.p | FlagB | FlagConstant)
+	} else {
+		cpu.push(cpu.p&^FlagB | FlagConstant)
+	}
+}
+
+func fetchVectorLo(cpu *CPU) {
+	if cpu.sequence == seqReset {
+		cpu.addr = ResetVector
+	}
+	cpu.pc = uint16(cpu.mem.Read(cpu.addr))
+	cpu.setFlag(FlagI, true)
+}
+
+func fetchVectorHi(cpu *CPU) {
+	cpu.pc |= uint16(cpu.mem.Read(cpu.addr+1)) << 8
+}
+
+// pullP pulls P as PLP does, the unused bit always reads 1.
+func pullP(cpu *CPU) {
+	cpu.p = cpu.pop() | FlagConstant
+}
+
+func pullAddrLo(cpu *CPU) {
+	cpu.addr = uint16(cpu.pop())
+}
+
+func pullAddrHi(cpu *CPU) {
+	cpu.addr |= uint16(cpu.pop()) << 8
+}
@@ -0,0 +1,70 @@
+package cpu
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/irq"
+)
+
+// TestDecimalMode runs the decimal mode test by Bruce Clark, it checks ADC
+// and SBC in decimal mode for every accumulator, operand and carry, valid BCD
+// or not, against results computed in binary mode.
+// test/roms/6502_decimal_test.s is the source of the binary.
+func TestDecimalMode(t *testing.T) {
+	const (
+		start     = 0x0200
+		halt      = 0x0203 // spins here when done
+		errorFlag = 0x10
+	)
+	b := &bus{}
+	data, err := os.ReadFile("../../../test/roms/6502_decimal_test.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b.mem[start:], data)
+	cpu := NewCPU(*slog.Default(), b, irq.NewController())
+	cpu.SetState(State{PC: start, P: FlagConstant, SP: 0xff})
+	for i := 0; cpu.pc != halt; i++ {
+		if i == 100_000_000 {
+			t.Fatalf("test does not finish, PC=%04x", cpu.pc)
+		}
+		b.log = b.log[:0]
+		cpu.step()
+	}
+	if b.mem[errorFlag] != 0 {
+		s := b.mem[0x11:0x21]
+		t.Errorf("decimal test failed at N1=%02x N2=%02x carry=%d: A=%02x P=%08b, predicted A=%02x",
+			s[0], s[1], cpu.y, s[7], s[8], s[11])
+	}
+}
+
+func TestDecimalModeExamples(t *testing.T) {
+	b := &bus{}
+	cpu := NewCPU(*slog.Default(), b, irq.NewController())
+	for _, tc := range []struct {
+		name    string
+		opcode  uint8
+		a, m, p uint8
+		want    uint8
+		wantP   uint8
+	}{
+		// N and V follow the intermediate sum $a5
+		{"58+46+1", 0x69, 0x58, 0x46, FlagC, 0x05, FlagC | FlagN | FlagV},
+		{"12+34", 0x69, 0x12, 0x34, 0, 0x46, 0},
+		// Z follows the binary sum $9a
+		{"99+01", 0x69, 0x99, 0x01, 0, 0x00, FlagC | FlagN},
+		{"79+00+1", 0x69, 0x79, 0x00, FlagC, 0x80, FlagN | FlagV},
+		{"46-12", 0xe9, 0x46, 0x12, FlagC, 0x34, FlagC},
+		{"32-02-1", 0xe9, 0x32, 0x02, 0, 0x29, FlagC},
+		{"12-21", 0xe9, 0x12, 0x21, FlagC, 0x91, FlagN},
+	} {
+		b.mem[0x1000], b.mem[0x1001] = tc.opcode, tc.m
+		cpu.SetState(State{PC: 0x1000, A: tc.a, P: FlagConstant | FlagD | tc.p, SP: 0xff})
+		cpu.step()
+		if s := cpu.State(); s.A != tc.want || s.P != FlagConstant|FlagD|tc.wantP {
+			t.Errorf("%s: A=%02x P=%08b, want A=%02x P=%08b", tc.name, s.A, s.P, tc.want, FlagConstant|FlagD|tc.wantP)
+		}
+	}
+}
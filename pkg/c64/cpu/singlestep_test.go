@@ -0,0 +1,162 @@
+package cpu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/irq"
+)
+
+// Per-opcode test vectors in the format of the SingleStepTests 65x02 suite,
+// https://github.com/SingleStepTests/65x02. Each file holds the cases of one
+// opcode, named by its hex value. The handcrafted vectors in test/singlestep
+// are run by default, point $SINGLESTEP_TESTS at a checkout of the 6502/v1
+// directory to run the full suite.
+const singleStepEnv = "SINGLESTEP_TESTS"
+
+type singleStepCase struct {
+	Name    string          `json:"name"`
+	Initial singleStepState `json:"initial"`
+	Final   singleStepState `json:"final"`
+	Cycles  [][3]any        `json:"cycles"` // address, value, "read" or "write"
+}
+
+type singleStepState struct {
+	PC  uint16      `json:"pc"`
+	S   uint8       `json:"s"`
+	A   uint8       `json:"a"`
+	X   uint8       `json:"x"`
+	Y   uint8       `json:"y"`
+	P   uint8       `json:"p"`
+	RAM [][2]uint16 `json:"ram"` // address, value
+}
+
+// busCycle is one bus access as logged by bus.
+type busCycle struct {
+	Addr  uint16
+	Value uint8
+	Kind  string
+}
+
+func (c busCycle) String() string {
+	return fmt.Sprintf("%s $%04x $%02x", c.Kind, c.Addr, c.Value)
+}
+
+// bus is a flat 64K memory logging every access.
+type bus struct {
+	mem [0x10000]uint8
+	log []busCycle
+}
+
+func (b *bus) Read(addr uint16) uint8 {
+	b.log = append(b.log, busCycle{addr, b.mem[addr], "read"})
+	return b.mem[addr]
+}
+
+func (b *bus) Write(addr uint16, v uint8) {
+	b.log = append(b.log, busCycle{addr, v, "write"})
+	b.mem[addr] = v
+}
+
+func (b *bus) ReadWord(addr uint16) uint16 {
+	return uint16(b.mem[addr]) | uint16(b.mem[addr+1])<<8
+}
+
+func (b *bus) ReadRom(addr uint16) uint8 { return b.mem[addr] }
+func (b *bus) VicRead(addr uint16) uint8 { return b.mem[addr] }
+
+func (b *bus) VicColorRead(addr uint16) uint8 { return b.mem[addr] }
+
+func TestSingleStep(t *testing.T) {
+	dir := os.Getenv(singleStepEnv)
+	if dir == "" {
+		dir = "../../../test/singlestep"
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no test vectors in %s", dir)
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cases []singleStepCase
+			if err := json.Unmarshal(data, &cases); err != nil {
+				t.Fatal(err)
+			}
+			failures := 0
+			for _, tc := range cases {
+				if diff := runSingleStep(tc); diff != "" {
+					if failures++; failures <= 5 {
+						t.Errorf("%s:\n%s", tc.Name, diff)
+					}
+				}
+			}
+			if failures > 5 {
+				t.Errorf("%d of %d cases failed", failures, len(cases))
+			}
+		})
+	}
+}
+
+// runSingleStep runs one instruction from the initial state and returns the
+// differences to the expected final state and bus cycles, if any.
+func runSingleStep(tc singleStepCase) string {
+	b := &bus{}
+	for _, m := range tc.Initial.RAM {
+		b.mem[m[0]] = uint8(m[1])
+	}
+	cpu := NewCPU(*slog.New(slog.NewTextHandler(io.Discard, nil)), b, irq.NewController())
+	in := tc.Initial
+	cpu.SetState(State{PC: in.PC, A: in.A, X: in.X, Y: in.Y, P: in.P, SP: in.S})
+	cpu.step()
+
+	var diff []string
+	check := func(name string, got, want uint16) {
+		if got != want {
+			diff = append(diff, fmt.Sprintf("  %s: got $%02x, want $%02x", name, got, want))
+		}
+	}
+	s, out := cpu.State(), tc.Final
+	check("pc", s.PC, out.PC)
+	check("s", uint16(s.SP), uint16(out.S))
+	check("a", uint16(s.A), uint16(out.A))
+	check("x", uint16(s.X), uint16(out.X))
+	check("y", uint16(s.Y), uint16(out.Y))
+	check("p", uint16(s.P), uint16(out.P))
+	for _, m := range out.RAM {
+		check(fmt.Sprintf("$%04x", m[0]), uint16(b.mem[m[0]]), m[1])
+	}
+
+	if tc.Cycles != nil {
+		for i := 0; i < max(len(tc.Cycles), len(b.log)); i++ {
+			var got, want string
+			if i < len(b.log) {
+				got = b.log[i].String()
+			}
+			if i < len(tc.Cycles) {
+				c := tc.Cycles[i]
+				addr, _ := c[0].(float64)
+				value, _ := c[1].(float64)
+				kind, _ := c[2].(string)
+				want = busCycle{uint16(addr), uint8(value), kind}.String()
+			}
+			if got != want {
+				diff = append(diff, fmt.Sprintf("  cycle %d: got %q, want %q", i+1, got, want))
+				break
+			}
+		}
+	}
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,161 @@
+// Package disasm turns 6502 machine code into text, using the opcode table
+// of the cpu package. The syntax is the one of the common assemblers:
+//
+//	LDA #$01
+//	STA ($fb),Y
+//	BNE $c010
+//
+// Undocumented opcodes use the mnemonics of "No More Secrets".
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+)
+
+// Symbols names addresses, an operand matching a symbol is printed by name.
+type Symbols map[uint16]string
+
+// Line is one disassembled instruction.
+type Line struct {
+	Addr     uint16
+	Bytes    []uint8
+	Mnemonic string
+	Operand  string
+	Illegal  bool // an undocumented opcode
+	// Target is the address the operand points at, the branch destination
+	// for relative branches. It is only valid if HasTarget is set.
+	Target    uint16
+	HasTarget bool
+}
+
+// String formats the line as in a machine code monitor, undocumented
+// opcodes are marked with a star.
+//
+//	c000  b1 fb     LDA ($fb),Y
+func (l Line) String() string {
+	var hex strings.Builder
+	for i, b := range l.Bytes {
+		if i > 0 {
+			hex.WriteByte(' ')
+		}
+		fmt.Fprintf(&hex, "%02x", b)
+	}
+	mark := " "
+	if l.Illegal {
+		mark = "*"
+	}
+	return strings.TrimRight(fmt.Sprintf("%04x  %-8s %s%s", l.Addr, hex.String(), mark, l.Text()), " ")
+}
+
+// Text is the instruction without address and bytes.
+func (l Line) Text() string {
+	if l.Operand == "" {
+		return l.Mnemonic
+	}
+	return l.Mnemonic + " " + l.Operand
+}
+
+// Length is the number of bytes of the instruction with opcode op.
+func Length(op uint8) int {
+	switch cpu.Instructions[op].Mode() {
+	case cpu.Implied, cpu.Accumulator:
+		return 1
+	case cpu.Absolute, cpu.IndexedAbsoluteX, cpu.IndexedAbsoluteY, cpu.AbsoluteIndirect:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Illegal reports whether op is an undocumented opcode.
+func Illegal(op uint8) bool {
+	return cpu.Instructions[op].Illegal()
+}
+
+// Disassemble decodes the instruction at addr. read must not have side
+// effects, as the bytes after an instruction may be I/O registers. syms may
+// be nil.
+func Disassemble(read func(addr uint16) uint8, addr uint16, syms Symbols) Line {
+	op := read(addr)
+	inst := cpu.Instructions[op]
+	l := Line{Addr: addr, Mnemonic: inst.Name(), Illegal: Illegal(op)}
+	for i := 0; i < Length(op); i++ {
+		l.Bytes = append(l.Bytes, read(addr+uint16(i)))
+	}
+	var zp uint8
+	var abs uint16
+	if len(l.Bytes) > 1 {
+		zp = l.Bytes[1]
+		abs = uint16(zp)
+	}
+	if len(l.Bytes) > 2 {
+		abs |= uint16(l.Bytes[2]) << 8
+	}
+
+	name := func(v uint16, digits int) string {
+		if s, ok := syms[v]; ok {
+			return s
+		}
+		return fmt.Sprintf("$%0*x", digits, v)
+	}
+	target := func(v uint16) {
+		l.Target, l.HasTarget = v, true
+	}
+	switch inst.Mode() {
+	case cpu.Accumulator:
+		l.Operand = "A"
+	case cpu.Immidiate:
+		l.Operand = fmt.Sprintf("#$%02x", zp)
+	case cpu.Zeropage:
+		target(abs)
+		l.Operand = name(abs, 2)
+	case cpu.IndexedZeropageX:
+		target(abs)
+		l.Operand = name(abs, 2) + ",X"
+	case cpu.IndexedZeropageY:
+		target(abs)
+		l.Operand = name(abs, 2) + ",Y"
+	case cpu.Absolute:
+		target(abs)
+		l.Operand = name(abs, 4)
+	case cpu.IndexedAbsoluteX:
+		target(abs)
+		l.Operand = name(abs, 4) + ",X"
+	case cpu.IndexedAbsoluteY:
+		target(abs)
+		l.Operand = name(abs, 4) + ",Y"
+	case cpu.AbsoluteIndirect:
+		target(abs)
+		l.Operand = "(" + name(abs, 4) + ")"
+	case cpu.IndexedIndirectX:
+		target(abs)
+		l.Operand = "(" + name(abs, 2) + ",X)"
+	case cpu.IndirectIndexedY:
+		target(abs)
+		l.Operand = "(" + name(abs, 2) + "),Y"
+	case cpu.Relative:
+		dest := addr + 2 + uint16(int8(zp))
+		target(dest)
+		l.Operand = name(dest, 4)
+	}
+	return l
+}
+
+// Range disassembles the instructions from addr up to, not including, end.
+// The last instruction may extend past end.
+func Range(read func(addr uint16) uint8, addr, end uint16, syms Symbols) []Line {
+	var lines []Line
+	for addr < end {
+		l := Disassemble(read, addr, syms)
+		lines = append(lines, l)
+		next := addr + uint16(len(l.Bytes))
+		if next < addr {
+			break // wrapped around
+		}
+		addr = next
+	}
+	return lines
+}
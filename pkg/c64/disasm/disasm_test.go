@@ -0,0 +1,69 @@
+package disasm
+
+import (
+	"testing"
+)
+
+func reader(addr uint16, code ...uint8) func(uint16) uint8 {
+	return func(a uint16) uint8 {
+		if i := int(a - addr); i < len(code) {
+			return code[i]
+		}
+		return 0
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	syms := Symbols{0xffd2: "CHROUT", 0x00fb: "ptr"}
+	for _, tc := range []struct {
+		addr uint16
+		code []uint8
+		want string
+	}{
+		{0xc000, []uint8{0xea}, "c000  ea        NOP"},
+		{0xc000, []uint8{0x0a}, "c000  0a        ASL A"},
+		{0xc000, []uint8{0xa9, 0x01}, "c000  a9 01     LDA #$01"},
+		{0xc000, []uint8{0xa5, 0x20}, "c000  a5 20     LDA $20"},
+		{0xc000, []uint8{0xb5, 0x20}, "c000  b5 20     LDA $20,X"},
+		{0xc000, []uint8{0xb6, 0x20}, "c000  b6 20     LDX $20,Y"},
+		{0xc000, []uint8{0xad, 0x20, 0xd0}, "c000  ad 20 d0  LDA $d020"},
+		{0xc000, []uint8{0xbd, 0x00, 0x04}, "c000  bd 00 04  LDA $0400,X"},
+		{0xc000, []uint8{0xb9, 0x00, 0x04}, "c000  b9 00 04  LDA $0400,Y"},
+		{0xc000, []uint8{0x6c, 0x14, 0x03}, "c000  6c 14 03  JMP ($0314)"},
+		{0xc000, []uint8{0xa1, 0x20}, "c000  a1 20     LDA ($20,X)"},
+		{0xc000, []uint8{0xb1, 0x20}, "c000  b1 20     LDA ($20),Y"},
+		{0xc000, []uint8{0xb1, 0xfb}, "c000  b1 fb     LDA (ptr),Y"},
+		{0xc000, []uint8{0x20, 0xd2, 0xff}, "c000  20 d2 ff  JSR CHROUT"},
+		{0xc010, []uint8{0xd0, 0xfe}, "c010  d0 fe     BNE $c010"},
+		{0xc010, []uint8{0x10, 0x10}, "c010  10 10     BPL $c022"},
+		{0xfffe, []uint8{0xf0, 0x00}, "fffe  f0 00     BEQ $0000"},
+		{0xc000, []uint8{0xa7, 0x20}, "c000  a7 20    *LAX $20"},
+		{0xc000, []uint8{0x02}, "c000  02       *JAM"},
+		{0xc000, []uint8{0x1a}, "c000  1a       *NOP"},
+		{0xc000, []uint8{0xeb, 0x01}, "c000  eb 01    *SBC #$01"},
+	} {
+		if got := Disassemble(reader(tc.addr, tc.code...), tc.addr, syms).String(); got != tc.want {
+			t.Errorf("%x: got %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	lines := Range(reader(0xc000, 0xa2, 0x00, 0xe8, 0xd0, 0xfd, 0x60), 0xc000, 0xc006, nil)
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Text())
+	}
+	want := []string{"LDX #$00", "INX", "BNE $c002", "RTS"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if l := lines[2]; !l.HasTarget || l.Target != 0xc002 {
+		t.Errorf("branch target = %04x, %v", l.Target, l.HasTarget)
+	}
+}
@@ -0,0 +1,63 @@
+// Package machinetest holds the fixtures shared by the tests that run code
+// on the emulator. Only tests import it.
+package machinetest
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+
+	"github.com/jejer/commando64/pkg/c64/asm"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+// T is the part of testing.TB the fixtures use.
+type T interface {
+	Helper()
+	Fatal(args ...any)
+}
+
+// RAM is a flat 64K memory, without banking or I/O.
+type RAM [0x10000]uint8
+
+func (r *RAM) Read(addr uint16) uint8     { return r[addr] }
+func (r *RAM) Write(addr uint16, v uint8) { r[addr] = v }
+
+// roms returns the directory of the test ROMs.
+func roms() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "../../../../test/roms")
+}
+
+// New returns a machine with the test ROMs and a discarding logger, past its
+// reset sequence.
+func New(t T) *machine.Machine {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	set, err := machine.LoadROMSet(roms())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := machine.New(machine.WithLogger(*logger), machine.WithROMSet(set))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.StepInstruction() // the reset sequence
+	return m
+}
+
+// Load returns a new machine about to run src from $c000 with interrupts
+// disabled.
+func Load(t T, src string) (*machine.Machine, *asm.Program) {
+	t.Helper()
+	m := New(t)
+	prog, err := asm.Assemble(src, 0xc000, m.Memory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := m.CPU().State()
+	s.PC, s.P = 0xc000, s.P|0x04
+	m.CPU().SetState(s)
+	return m, prog
+}
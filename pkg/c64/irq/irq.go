@@ -0,0 +1,89 @@
+package irq
+
+// The IRQ and NMI inputs of the 6510 are open collector lines, any source can
+// pull them low and a line stays low until every source has released it.
+// IRQ is level triggered: the CPU serves it at instruction boundaries for as
+// long as it is asserted and the I flag is clear.
+// NMI is edge triggered: only the transition from released to asserted
+// raises an interrupt, a source must release the line to raise another one.
+// https://www.c64-wiki.com/wiki/Interrupt
+
+type Source uint8
+
+const (
+	SourceVIC Source = 1 << iota
+	SourceCIA1
+	SourceCIA2
+	SourceRestore
+)
+
+type Controller struct {
+	irq        Source // sources asserting IRQ
+	nmi        Source // sources asserting NMI
+	nmiPending bool   // NMI edge not yet served by the CPU
+}
+
+// State is the interrupt line state captured in machine snapshots.
+type State struct {
+	IRQ        uint8
+	NMI        uint8
+	NMIPending bool
+}
+
+func NewController() *Controller {
+	return &Controller{}
+}
+
+func (c *Controller) State() State {
+	return State{IRQ: uint8(c.irq), NMI: uint8(c.nmi), NMIPending: c.nmiPending}
+}
+
+func (c *Controller) SetState(s State) {
+	c.irq = Source(s.IRQ)
+	c.nmi = Source(s.NMI)
+	c.nmiPending = s.NMIPending
+}
+
+// SetIRQ asserts or releases the IRQ line on behalf of src.
+func (c *Controller) SetIRQ(src Source, asserted bool) {
+	if asserted {
+		c.irq |= src
+	} else {
+		c.irq &^= src
+	}
+}
+
+// SetNMI asserts or releases the NMI line on behalf of src.
+func (c *Controller) SetNMI(src Source, asserted bool) {
+	if !asserted {
+		c.nmi &^= src
+		return
+	}
+	if c.nmi == 0 {
+		c.nmiPending = true
+	}
+	c.nmi |= src
+}
+
+// Reset forgets a pending NMI edge. The sources release their lines on
+// their own reset, the VIC has no reset input and keeps its IRQ.
+func (c *Controller) Reset() {
+	c.nmiPending = false
+}
+
+// IRQ reports whether any source asserts the IRQ line.
+func (c *Controller) IRQ() bool {
+	return c.irq != 0
+}
+
+// NMI reports whether an NMI edge is pending without acknowledging it.
+func (c *Controller) NMI() bool {
+	return c.nmiPending
+}
+
+// TakeNMI reports whether an NMI edge is pending and acknowledges it.
+func (c *Controller) TakeNMI() bool {
+	pending := c.nmiPending
+	c.nmiPending = false
+	return pending
+}
@@ -0,0 +1,39 @@
+package irq
+
+import "testing"
+
+func TestIRQLevel(t *testing.T) {
+	c := NewController()
+	c.SetIRQ(SourceVIC, true)
+	c.SetIRQ(SourceCIA1, true)
+	c.SetIRQ(SourceVIC, false)
+	if !c.IRQ() {
+		t.Fatal("IRQ released while CIA1 still asserts it")
+	}
+	c.SetIRQ(SourceCIA1, false)
+	if c.IRQ() {
+		t.Fatal("IRQ asserted with no source")
+	}
+}
+
+func TestNMIEdge(t *testing.T) {
+	c := NewController()
+	c.SetNMI(SourceCIA2, true)
+	if !c.TakeNMI() {
+		t.Fatal("NMI edge not pending")
+	}
+	if c.TakeNMI() {
+		t.Fatal("NMI served twice for one edge")
+	}
+	// a second source on an already low line is no new edge
+	c.SetNMI(SourceRestore, true)
+	c.SetNMI(SourceCIA2, false)
+	if c.TakeNMI() {
+		t.Fatal("NMI raised without an edge")
+	}
+	c.SetNMI(SourceRestore, false)
+	c.SetNMI(SourceCIA2, true)
+	if !c.TakeNMI() {
+		t.Fatal("NMI edge after release not pending")
+	}
+}
@@ -0,0 +1,272 @@
+// Package lorenz runs the Wolfgang Lorenz C64 test suite on the full machine.
+//
+// Every test is a PRG starting with "10 SYS 2070". It prints its name and
+// result through the KERNAL, waits for a key after an error, and chains to
+// the next test by setting up a file name and jumping into the BASIC LOAD
+// routine. The runner traps these routines: a test passes when it loads the
+// next one without having waited for a key, the run ends when a test asks
+// for a file that is not in the suite.
+package lorenz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/machine"
+	"github.com/jejer/commando64/pkg/c64/memory"
+)
+
+const (
+	// BASIC main loop, reached once the machine is at READY
+	basicMain uint16 = 0xa480
+	// BASIC LOAD, after the parameters are set up
+	basicLoad uint16 = 0xe16f
+	chrout    uint16 = 0xffd2
+	getin     uint16 = 0xffe4
+
+	fileNameLen  uint16 = 0x00b7
+	fileNamePtr  uint16 = 0x00bb
+	loadEnd      uint16 = 0x00ae
+	basicVarTab  uint16 = 0x002d
+	testStartPC  uint16 = 0x0816 // SYS 2070
+	stackPointer uint8  = 0xfd
+
+	// DefaultTimeout is the number of cycles a single test may run,
+	// about 100 seconds on a PAL machine.
+	DefaultTimeout = 100_000_000
+)
+
+// Result is the outcome of one test.
+type Result struct {
+	Name   string
+	Passed bool
+	Output string // text printed by the test
+	Cycles uint64
+}
+
+type Runner struct {
+	m     *machine.Machine
+	mem   *memory.C64MemoryBus
+	files map[string]string // test name to file in fsys
+	fsys  fs.FS
+	first string
+
+	// Timeout is the number of cycles after which a test fails.
+	Timeout uint64
+
+	results []Result
+	current *Result
+	output  strings.Builder
+	failed  bool
+	start   uint64
+	done    bool
+	err     error
+}
+
+// NewRunner prepares a run of the test programs in the root of fsys on m,
+// starting with the test named first, "start" for the full suite.
+func NewRunner(m *machine.Machine, fsys fs.FS, first string) (*Runner, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("lorenz: %w", err)
+	}
+	r := &Runner{m: m, mem: m.Memory(), fsys: fsys, first: first, files: map[string]string{}, Timeout: DefaultTimeout}
+	for _, e := range entries {
+		if !e.IsDir() {
+			r.files[testName(e.Name())] = e.Name()
+		}
+	}
+	if _, ok := r.files[testName(first)]; !ok {
+		return nil, fmt.Errorf("lorenz: test %q not found", first)
+	}
+	return r, nil
+}
+
+// testName normalizes a file or test name, the suite names some files with
+// a leading space.
+func testName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.TrimSuffix(name, ".prg")
+}
+
+// Run boots the machine and runs the chain of tests until it ends, a test
+// times out or the CPU jams. The traps run within StepFrame, so they read
+// the cycles from the clock as the machine is locked.
+func (r *Runner) Run() ([]Result, error) {
+	c := r.m.CPU()
+	c.AddTrap(basicMain, r.ready)
+	c.AddTrap(basicLoad, r.load)
+	c.AddTrap(chrout, r.print)
+	c.AddTrap(getin, r.waitKey)
+	defer func() {
+		for _, addr := range []uint16{basicMain, basicLoad, chrout, getin} {
+			c.RemoveTrap(addr)
+		}
+	}()
+
+	for !r.done && r.err == nil {
+		r.m.StepFrame()
+		if err := c.Err(); err != nil {
+			r.finish(fmt.Sprintf("\n%v", err))
+			break
+		}
+		if r.current == nil && len(r.results) == 0 && r.m.Clock().Cycles() > r.Timeout {
+			return nil, errors.New("lorenz: the machine did not reach READY")
+		}
+		if r.current != nil && r.m.Clock().Cycles()-r.start > r.Timeout {
+			r.finish(fmt.Sprintf("\ntimeout after %d cycles", r.Timeout))
+			break
+		}
+	}
+	return r.results, r.err
+}
+
+// ready starts the first test once the machine has booted. A test returning
+// to BASIC ends the run.
+func (r *Runner) ready(c *cpu.CPU) {
+	if len(r.results) == 0 && r.current == nil {
+		r.startTest(c, r.first)
+		return
+	}
+	if r.current != nil {
+		r.finish("")
+	}
+	r.done = true
+}
+
+// load finishes the running test and starts the one it asks for.
+func (r *Runner) load(c *cpu.CPU) {
+	n := r.mem.Peek(fileNameLen)
+	ptr := uint16(r.mem.Peek(fileNamePtr)) | uint16(r.mem.Peek(fileNamePtr+1))<<8
+	name := make([]byte, n)
+	for i := range name {
+		name[i] = r.mem.Peek(ptr + uint16(i))
+	}
+	r.finish("")
+
+	next := petsciiToASCII(name)
+	if _, ok := r.files[testName(next)]; !ok {
+		r.done = true
+		return
+	}
+	for _, res := range r.results {
+		if res.Name == testName(next) {
+			r.done = true // the suite starts over
+			return
+		}
+	}
+	r.startTest(c, next)
+}
+
+func (r *Runner) print(c *cpu.CPU) {
+	if r.current != nil {
+		r.output.WriteString(petsciiToASCII([]byte{c.State().A}))
+	}
+}
+
+// waitKey marks the running test as failed and answers the key prompt with
+// a space so that the test goes on.
+func (r *Runner) waitKey(c *cpu.CPU) {
+	if r.current == nil {
+		return
+	}
+	r.failed = true
+	c.Return()
+	s := c.State()
+	s.A = ' '
+	s.P &^= cpu.FlagZ | cpu.FlagN
+	c.SetState(s)
+}
+
+// startTest loads the test program and jumps to it with an empty stack.
+func (r *Runner) startTest(c *cpu.CPU, name string) {
+	data, err := fs.ReadFile(r.fsys, r.files[testName(name)])
+	if err == nil && len(data) < 2 {
+		err = fmt.Errorf("%s: not a PRG file", name)
+	}
+	if err != nil {
+		r.err = fmt.Errorf("lorenz: %w", err)
+		return
+	}
+	addr := uint16(data[0]) | uint16(data[1])<<8
+	for i, v := range data[2:] {
+		r.mem.Write(addr+uint16(i), v)
+	}
+	end := addr + uint16(len(data)-2)
+	for _, p := range []uint16{loadEnd, basicVarTab} {
+		r.mem.Write(p, uint8(end))
+		r.mem.Write(p+1, uint8(end>>8))
+	}
+
+	r.current = &Result{Name: testName(name)}
+	r.output.Reset()
+	r.failed = false
+	r.start = r.m.Clock().Cycles()
+
+	s := c.State()
+	s.PC = testStartPC
+	s.SP = stackPointer
+	c.SetState(s)
+}
+
+// finish records the result of the running test, msg is appended to its
+// output.
+func (r *Runner) finish(msg string) {
+	if r.current == nil {
+		return
+	}
+	r.output.WriteString(msg)
+	r.current.Output = strings.TrimSpace(r.output.String())
+	r.current.Passed = !r.failed && msg == ""
+	r.current.Cycles = r.m.Clock().Cycles() - r.start
+	r.results = append(r.results, *r.current)
+	r.current = nil
+}
+
+// petsciiToASCII converts text printed in the upper case character set,
+// control codes other than return are dropped.
+func petsciiToASCII(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		switch {
+		case c == 0x0d:
+			s.WriteByte('\n')
+		case c >= 'A' && c <= 'Z':
+			s.WriteByte(c - 'A' + 'a')
+		case c >= 0xc1 && c <= 0xda:
+			s.WriteByte(c - 0xc1 + 'A')
+		case c >= 0x20 && c < 0x60:
+			s.WriteByte(c)
+		}
+	}
+	return s.String()
+}
+
+// WriteReport writes one line per test and a summary, with the output of
+// the failed tests.
+func WriteReport(w io.Writer, results []Result) error {
+	failed := 0
+	for _, res := range results {
+		status := "ok"
+		if !res.Passed {
+			status = "FAILED"
+			failed++
+		}
+		if _, err := fmt.Fprintf(w, "%-12s %-6s %12d cycles\n", res.Name, status, res.Cycles); err != nil {
+			return err
+		}
+		if !res.Passed && res.Output != "" {
+			for _, line := range strings.Split(res.Output, "\n") {
+				if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d tests, %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	return err
+}
@@ -0,0 +1,105 @@
+package lorenz
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jejer/commando64/pkg/c64/asm"
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+// testPRG builds a test program in the layout of the suite: the SYS 2070
+// line, body at $0816, then the chain to the test named next.
+func testPRG(t *testing.T, body, next string) []byte {
+	src := fmt.Sprintf(`
+		.org $0801
+		.word $080b, 10
+		.byte $9e, "2070", 0, 0, 0
+		.org $0816
+%s
+		lda #0
+		sta $0a
+		sta $b9
+		lda #%d
+		sta $b7
+		lda #<name
+		sta $bb
+		lda #>name
+		sta $bc
+		pla
+		pla
+		jmp $e16f
+name:	.byte "%s"
+`, body, len(next), strings.ToUpper(next))
+	var mem machinetest.RAM
+	prog, err := asm.Assemble(src, 0, &mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{0x01, 0x08}, mem[prog.Start:prog.End]...)
+}
+
+func TestRunner(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	roms, err := machine.LoadROMSet("../../../test/roms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := machine.New(machine.WithLogger(*logger), machine.WithROMSet(roms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the load trap peeks at the file name
+	nameReads := 0
+	m.AddAccessHook(func(addr uint16, v uint8, write bool) {
+		if !write && m.CPU().State().PC == basicLoad && (addr == fileNameLen || addr == fileNamePtr) {
+			nameReads++
+		}
+	})
+
+	fsys := fstest.MapFS{
+		" start": {Data: testPRG(t, `
+		lda #'O'
+		jsr $ffd2
+		lda #'K'
+		jsr $ffd2`, "next")},
+		// waits for a key and chains to a test not in the suite
+		"next.prg": {Data: testPRG(t, `
+		lda #'X'
+		jsr $ffd2
+		jsr $ffe4`, "end")},
+	}
+	r, err := NewRunner(m, fsys, "start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nameReads != 0 {
+		t.Errorf("%d reads of the file name by the load trap", nameReads)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want 2", results)
+	}
+	if res := results[0]; res.Name != "start" || !res.Passed || res.Output != "ok" {
+		t.Errorf("start: %+v", res)
+	}
+	if res := results[1]; res.Name != "next" || res.Passed || res.Output != "x" {
+		t.Errorf("next: %+v", res)
+	}
+
+	var report strings.Builder
+	if err := WriteReport(&report, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "2 tests, 1 passed, 1 failed") {
+		t.Errorf("report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,133 @@
+package machine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+const debugProgram = `
+		ldx #0
+loop:	inx
+		stx $0400
+		lda $d012
+		cpx #10
+		bne loop
+done:	jmp done`
+
+func TestBreakpoints(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		bp    machine.Breakpoint
+		wantX uint8
+		want  machine.Break
+	}{
+		{"exec", machine.Breakpoint{Access: machine.Exec, From: 0xc002, To: 0xc002},
+			0, machine.Break{Access: machine.Exec, Addr: 0xc002, Value: 0xe8, PC: 0xc002}},
+		{"ignore", machine.Breakpoint{Access: machine.Exec, From: 0xc002, To: 0xc002, Ignore: 2},
+			2, machine.Break{Access: machine.Exec, Addr: 0xc002, Value: 0xe8, PC: 0xc002}},
+		{"condition", machine.Breakpoint{Access: machine.Exec, From: 0xc000, To: 0xc0ff, Condition: "X == 5 && @$0400 == 4"},
+			5, machine.Break{Access: machine.Exec, Addr: 0xc003, Value: 0x8e, PC: 0xc003}},
+		{"write", machine.Breakpoint{Access: machine.Write, From: 0x0400, To: 0x07e7, Ignore: 6},
+			7, machine.Break{Access: machine.Write, Addr: 0x0400, Value: 7, PC: 0xc003}},
+		{"io read", machine.Breakpoint{Access: machine.Read, From: 0xd012, To: 0xd012},
+			1, machine.Break{Access: machine.Read, Addr: 0xd012, PC: 0xc006}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := machinetest.Load(t, debugProgram)
+			id, err := m.AddBreakpoint(tc.bp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []machine.Break
+			m.OnBreak(func(b machine.Break) { got = append(got, b) })
+			m.StepFrame()
+			if len(got) != 1 {
+				t.Fatalf("breaks %v", got)
+			}
+			b := got[0]
+			if b.Breakpoint.ID != id || b.Access != tc.want.Access || b.Addr != tc.want.Addr || b.PC != tc.want.PC ||
+				(tc.want.Access != machine.Read && b.Value != tc.want.Value) {
+				t.Errorf("break %v, want %v", b, tc.want)
+			}
+			if s := m.CPU().State(); s.X != tc.wantX || !m.CPU().InstructionDone() {
+				t.Errorf("X = %d, want %d", s.X, tc.wantX)
+			}
+			if !m.Paused() {
+				t.Error("not paused")
+			}
+
+			// stepping on runs the instruction the execution break stopped at
+			pc := m.CPU().State().PC
+			m.StepInstruction()
+			if m.CPU().State().PC == pc && tc.bp.Access == machine.Exec {
+				t.Error("did not resume from the break")
+			}
+		})
+	}
+}
+
+func TestTemporaryBreakpoint(t *testing.T) {
+	m, _ := machinetest.Load(t, debugProgram)
+	if _, err := m.AddBreakpoint(machine.Breakpoint{Access: machine.Exec, From: 0xc002, To: 0xc002, Temporary: true}); err != nil {
+		t.Fatal(err)
+	}
+	m.StepFrame()
+	if s := m.CPU().State(); s.PC != 0xc002 || len(m.Breakpoints()) != 0 {
+		t.Fatalf("PC = %04x, breakpoints %v", s.PC, m.Breakpoints())
+	}
+	m.StepFrame()
+	if s := m.CPU().State(); s.PC < 0xc00d || s.PC > 0xc00f || s.X != 10 {
+		t.Errorf("PC = %04x X = %d, want the loop done", s.PC, s.X)
+	}
+}
+
+func TestBreakpointPausesRun(t *testing.T) {
+	m, _ := machinetest.Load(t, debugProgram)
+	m.SetSpeed(1000)
+	if _, err := m.AddBreakpoint(machine.Breakpoint{Access: machine.Exec, From: 0xc00d, To: 0xc00d}); err != nil {
+		t.Fatal(err)
+	}
+	hit := make(chan machine.Break, 1)
+	m.OnBreak(func(b machine.Break) { hit <- b })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	select {
+	case b := <-hit:
+		if b.PC != 0xc00d {
+			t.Errorf("break %v", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no break")
+	}
+	if !m.Paused() {
+		t.Error("not paused")
+	}
+	m.Stop()
+	<-done
+}
+
+// TestWatchColorRAM checks the VIC's color RAM fetches do not trigger a read
+// watchpoint.
+func TestWatchColorRAM(t *testing.T) {
+	m, _ := machinetest.Load(t, `
+		lda #$1b
+		sta $d011   ; display on
+loop:	jmp loop`)
+	if _, err := m.AddBreakpoint(machine.Breakpoint{Access: machine.Read, From: 0xd800, To: 0xdbe7}); err != nil {
+		t.Fatal(err)
+	}
+	var got []machine.Break
+	m.OnBreak(func(b machine.Break) { got = append(got, b) })
+	for i := 0; i < 3; i++ {
+		m.StepFrame()
+	}
+	if len(got) != 0 {
+		t.Errorf("breaks %v", got)
+	}
+}
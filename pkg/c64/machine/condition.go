@@ -0,0 +1,213 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+)
+
+// A condition is a breakpoint expression over the registers and memory:
+//
+//	A == $20 && X >= 3
+//	@$d012 == $80 || (P & $02) != 0
+//
+// The registers are A, X, Y, SP, P and PC, @ reads a byte of memory without
+// side effects. Numbers are decimal, $hex or %binary. The operators are, by
+// increasing precedence, ||, &&, the comparisons == != < <= > >=, + - & |,
+// and the unary ! - @. The condition holds if the result is not 0.
+type condition func(s cpu.State, peek func(uint16) uint8) int
+
+type condParser struct {
+	s   string
+	pos int
+}
+
+func parseCondition(s string) (condition, error) {
+	p := &condParser{s: s}
+	c, err := p.or()
+	if err == nil && p.skip() < len(p.s) {
+		err = fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("machine: condition %q: %w", s, err)
+	}
+	return c, nil
+}
+
+func (p *condParser) skip() int {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos
+}
+
+// accept consumes op if it comes next.
+func (p *condParser) accept(op string) bool {
+	if strings.HasPrefix(p.s[p.skip():], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *condParser) or() (condition, error) {
+	l, err := p.and()
+	for err == nil && p.accept("||") {
+		var r condition
+		if r, err = p.and(); err == nil {
+			l0 := l
+			l = func(s cpu.State, peek func(uint16) uint8) int {
+				return boolInt(l0(s, peek) != 0 || r(s, peek) != 0)
+			}
+		}
+	}
+	return l, err
+}
+
+func (p *condParser) and() (condition, error) {
+	l, err := p.compare()
+	for err == nil && p.accept("&&") {
+		var r condition
+		if r, err = p.compare(); err == nil {
+			l0 := l
+			l = func(s cpu.State, peek func(uint16) uint8) int {
+				return boolInt(l0(s, peek) != 0 && r(s, peek) != 0)
+			}
+		}
+	}
+	return l, err
+}
+
+func (p *condParser) compare() (condition, error) {
+	l, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	// the two character operators first
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		r, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		cmp := map[string]func(a, b int) bool{
+			"==": func(a, b int) bool { return a == b },
+			"!=": func(a, b int) bool { return a != b },
+			"<=": func(a, b int) bool { return a <= b },
+			">=": func(a, b int) bool { return a >= b },
+			"<":  func(a, b int) bool { return a < b },
+			">":  func(a, b int) bool { return a > b },
+		}[op]
+		return func(s cpu.State, peek func(uint16) uint8) int {
+			return boolInt(cmp(l(s, peek), r(s, peek)))
+		}, nil
+	}
+	return l, nil
+}
+
+func (p *condParser) sum() (condition, error) {
+	l, err := p.unary()
+	for err == nil {
+		p.skip()
+		if p.pos == len(p.s) || strings.IndexByte("+-&|", p.s[p.pos]) < 0 ||
+			strings.HasPrefix(p.s[p.pos:], "&&") || strings.HasPrefix(p.s[p.pos:], "||") {
+			break
+		}
+		op := p.s[p.pos]
+		p.pos++
+		var r condition
+		if r, err = p.unary(); err != nil {
+			break
+		}
+		l0 := l
+		l = func(s cpu.State, peek func(uint16) uint8) int {
+			a, b := l0(s, peek), r(s, peek)
+			switch op {
+			case '+':
+				return a + b
+			case '-':
+				return a - b
+			case '&':
+				return a & b
+			}
+			return a | b
+		}
+	}
+	return l, err
+}
+
+func (p *condParser) unary() (condition, error) {
+	for _, op := range []string{"!", "-", "@"} {
+		if !p.accept(op) {
+			continue
+		}
+		c, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(s cpu.State, peek func(uint16) uint8) int { return boolInt(c(s, peek) == 0) }, nil
+		case "-":
+			return func(s cpu.State, peek func(uint16) uint8) int { return -c(s, peek) }, nil
+		}
+		return func(s cpu.State, peek func(uint16) uint8) int { return int(peek(uint16(c(s, peek)))) }, nil
+	}
+	return p.primary()
+}
+
+func (p *condParser) primary() (condition, error) {
+	if p.accept("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return c, nil
+	}
+	start := p.skip()
+	for p.pos < len(p.s) && (p.s[p.pos] == '$' || p.s[p.pos] == '%' ||
+		p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos]|0x20 >= 'a' && p.s[p.pos]|0x20 <= 'z') {
+		p.pos++
+	}
+	tok := p.s[start:p.pos]
+	if tok == "" {
+		return nil, fmt.Errorf("missing operand at %q", p.s[start:])
+	}
+	registers := map[string]func(s cpu.State) int{
+		"A":  func(s cpu.State) int { return int(s.A) },
+		"X":  func(s cpu.State) int { return int(s.X) },
+		"Y":  func(s cpu.State) int { return int(s.Y) },
+		"SP": func(s cpu.State) int { return int(s.SP) },
+		"P":  func(s cpu.State) int { return int(s.P) },
+		"PC": func(s cpu.State) int { return int(s.PC) },
+	}
+	if r, ok := registers[strings.ToUpper(tok)]; ok {
+		return func(s cpu.State, _ func(uint16) uint8) int { return r(s) }, nil
+	}
+	base, digits := 10, tok
+	switch tok[0] {
+	case '$':
+		base, digits = 16, tok[1:]
+	case '%':
+		base, digits = 2, tok[1:]
+	}
+	v, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %q", tok)
+	}
+	return func(cpu.State, func(uint16) uint8) int { return int(v) }, nil
+}
@@ -0,0 +1,280 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/jejer/commando64/pkg/c64/asm"
+	"github.com/jejer/commando64/pkg/c64/memory"
+)
+
+// Access selects what a breakpoint watches, the kinds can be combined.
+type Access uint8
+
+const (
+	Exec  Access = 1 << iota // an instruction starting in the range
+	Read                     // a CPU read, dummy reads included
+	Write                    // a CPU write
+)
+
+func (a Access) String() string {
+	s := ""
+	for i, name := range []string{"exec", "read", "write"} {
+		if a&(1<<i) != 0 {
+			if s != "" {
+				s += "|"
+			}
+			s += name
+		}
+	}
+	return s
+}
+
+// Breakpoint stops the machine on an access to an address range, I/O
+// registers included. An execution breakpoint stops before the instruction,
+// a watchpoint after the instruction that made the access.
+type Breakpoint struct {
+	ID       int
+	Access   Access
+	From, To uint16 // inclusive
+	// Condition must hold for a hit, see condition.go for the syntax.
+	// Empty always holds.
+	Condition string
+	// Ignore is the number of hits that pass before it breaks.
+	Ignore int
+	// Temporary breakpoints are removed at their first break.
+	Temporary bool
+	// Hits counts the accesses in the range that met the condition.
+	Hits int
+
+	cond condition
+}
+
+// Break tells why the machine stopped.
+type Break struct {
+	Breakpoint Breakpoint
+	Access     Access // the access that hit
+	Addr       uint16
+	Value      uint8  // read or written, the opcode for Exec
+	PC         uint16 // of the instruction that made the access
+}
+
+func (b Break) String() string {
+	return fmt.Sprintf("breakpoint %d: %s $%04x ($%02x) at $%04x", b.Breakpoint.ID, b.Access, b.Addr, b.Value, b.PC)
+}
+
+type debugger struct {
+	breakpoints []*Breakpoint
+	lastID      int
+	onBreak     func(Break)
+	watchHook   int // id of the memory hook, 0 if none
+
+	pc       uint16 // of the instruction in progress
+	hit      *Break // waits for the instruction to complete
+	skipping bool   // the execution break at skipPC was reported
+	skipPC   uint16
+}
+
+// AddBreakpoint adds bp and returns its ID. ID and Hits of bp are ignored.
+func (m *Machine) AddBreakpoint(bp Breakpoint) (int, error) {
+	if bp.Access == 0 || bp.Access&^(Exec|Read|Write) != 0 {
+		return 0, fmt.Errorf("machine: bad breakpoint access %d", bp.Access)
+	}
+	if bp.To < bp.From {
+		return 0, fmt.Errorf("machine: breakpoint range $%04x-$%04x ends before it starts", bp.From, bp.To)
+	}
+	if bp.Condition != "" {
+		cond, err := parseCondition(bp.Condition)
+		if err != nil {
+			return 0, err
+		}
+		bp.cond = cond
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.debug == nil {
+		m.debug = &debugger{}
+	}
+	m.debug.lastID++
+	bp.ID, bp.Hits = m.debug.lastID, 0
+	m.debug.breakpoints = append(m.debug.breakpoints, &bp)
+	m.updateWatch()
+	return bp.ID, nil
+}
+
+// RemoveBreakpoint removes the breakpoint with id, it reports whether there
+// was one.
+func (m *Machine) RemoveBreakpoint(id int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.removeBreakpoint(id)
+}
+
+func (m *Machine) removeBreakpoint(id int) bool {
+	if m.debug == nil {
+		return false
+	}
+	for i, bp := range m.debug.breakpoints {
+		if bp.ID == id {
+			m.debug.breakpoints = append(m.debug.breakpoints[:i], m.debug.breakpoints[i+1:]...)
+			m.updateWatch()
+			return true
+		}
+	}
+	return false
+}
+
+// AddAccessHook adds a hook on the CPU memory accesses and returns its id
+// for RemoveAccessHook.
+func (m *Machine) AddAccessHook(h memory.AccessHook) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mem.AddAccessHook(h)
+}
+
+// RemoveAccessHook removes the hook with id.
+func (m *Machine) RemoveAccessHook(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mem.RemoveAccessHook(id)
+}
+
+// Assemble assembles src at addr into the memory the CPU sees. The monitor
+// writes neither call the access hooks nor trigger watchpoints.
+func (m *Machine) Assemble(addr uint16, src string) (*asm.Program, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return asm.Assemble(src, addr, monitorMemory{m.mem})
+}
+
+// monitorMemory peeks and pokes the memory bus.
+type monitorMemory struct{ mem *memory.C64MemoryBus }
+
+func (mm monitorMemory) Read(addr uint16) uint8     { return mm.mem.Peek(addr) }
+func (mm monitorMemory) Write(addr uint16, v uint8) { mm.mem.Poke(addr, v) }
+
+// Breakpoints returns the breakpoints with their hit counts.
+func (m *Machine) Breakpoints() []Breakpoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.debug == nil {
+		return nil
+	}
+	bps := make([]Breakpoint, len(m.debug.breakpoints))
+	for i, bp := range m.debug.breakpoints {
+		bps[i] = *bp
+	}
+	return bps
+}
+
+// OnBreak sets the function called when a breakpoint stops the machine, nil
+// removes it. The machine is paused before, fn runs on the goroutine that
+// stepped the machine and may call its methods.
+func (m *Machine) OnBreak(fn func(Break)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.debug == nil {
+		m.debug = &debugger{}
+	}
+	m.debug.onBreak = fn
+}
+
+// updateWatch hooks the memory bus while there are watchpoints.
+func (m *Machine) updateWatch() {
+	d := m.debug
+	watch := false
+	for _, bp := range d.breakpoints {
+		watch = watch || bp.Access&(Read|Write) != 0
+	}
+	switch {
+	case watch && d.watchHook == 0:
+		d.watchHook = m.mem.AddAccessHook(m.watch)
+	case !watch && d.watchHook != 0:
+		m.mem.RemoveAccessHook(d.watchHook)
+		d.watchHook = 0
+	}
+}
+
+// step runs one cycle, it reports whether a breakpoint stops the machine.
+// An execution break is checked at the instruction boundary, a watchpoint
+// hit stops the machine once its instruction is complete.
+func (m *Machine) step() bool {
+	d := m.debug
+	if d == nil || (len(d.breakpoints) == 0 && d.hit == nil) {
+		m.clock.Step()
+		return false
+	}
+	if m.cpu.InstructionDone() && d.hit == nil {
+		d.pc = m.cpu.State().PC
+		if !d.skipping || d.skipPC != d.pc {
+			d.skipping = false
+			if m.check(Exec, d.pc, m.mem.Peek(d.pc)) {
+				d.skipping, d.skipPC = true, d.pc
+				return true
+			}
+		}
+	}
+	m.clock.Step()
+	if !m.cpu.InstructionDone() {
+		d.skipping = false
+	}
+	return d.hit != nil && m.cpu.InstructionDone()
+}
+
+// watch is the memory access hook.
+func (m *Machine) watch(addr uint16, v uint8, write bool) {
+	access := Read
+	if write {
+		access = Write
+	}
+	m.check(access, addr, v)
+}
+
+// check records a break if a breakpoint hits, it reports whether one did.
+func (m *Machine) check(access Access, addr uint16, v uint8) bool {
+	d := m.debug
+	if d.hit != nil {
+		return false
+	}
+	for _, bp := range d.breakpoints {
+		if bp.Access&access == 0 || addr < bp.From || addr > bp.To {
+			continue
+		}
+		if bp.cond != nil && bp.cond(m.cpu.State(), m.mem.Peek) == 0 {
+			continue
+		}
+		if bp.Hits++; bp.Hits <= bp.Ignore {
+			continue
+		}
+		d.hit = &Break{Breakpoint: *bp, Access: access, Addr: addr, Value: v, PC: d.pc}
+		if bp.Temporary {
+			m.removeBreakpoint(bp.ID)
+		}
+		return true
+	}
+	return false
+}
+
+// takeBreak returns the break that stopped the last step, if any, and the
+// function to notify. It is called with the machine locked.
+func (m *Machine) takeBreak() (*Break, func(Break)) {
+	if m.debug == nil || m.debug.hit == nil {
+		return nil, nil
+	}
+	b := m.debug.hit
+	m.debug.hit = nil
+	return b, m.debug.onBreak
+}
+
+// notifyBreak pauses the machine and notifies the host of a break, it is
+// called after the machine is unlocked.
+func (m *Machine) notifyBreak(b *Break, fn func(Break)) {
+	if b == nil {
+		return
+	}
+	m.logger.Info("Break", "break", b.String())
+	m.Pause()
+	if fn != nil {
+		fn(*b)
+	}
+}
@@ -0,0 +1,45 @@
+package machine
+
+import "testing"
+
+func TestBreakpointErrors(t *testing.T) {
+	m, _ := newTestMachine(t)
+	for _, bp := range []Breakpoint{
+		{From: 0xc000, To: 0xc000},
+		{Access: Exec, From: 0xc001, To: 0xc000},
+		{Access: Exec, Condition: "A =="},
+		{Access: Exec, Condition: "Q == 1"},
+		{Access: Exec, Condition: "(A == 1"},
+	} {
+		if _, err := m.AddBreakpoint(bp); err == nil {
+			t.Errorf("%+v accepted", bp)
+		}
+	}
+}
+
+func TestCondition(t *testing.T) {
+	m, _ := newTestMachine(t)
+	m.Memory().Write(0x10, 0x42)
+	s := m.CPU().State()
+	s.PC, s.A, s.X, s.Y, s.P = 0xc000, 0x20, 3, 0, 0x03
+	for expr, want := range map[string]bool{
+		"A == $20":                true,
+		"A == $20 && X > 3":       false,
+		"A == $20 && X >= 3":      true,
+		"A != 32 || @$10 == $42":  true,
+		"(P & %10) != 0":          true,
+		"!(P & 4)":                true,
+		"@(X + 13) == 66":         true,
+		"PC - $c000 == 0 && Y <2": true,
+		"-1 < 0":                  true,
+	} {
+		c, err := parseCondition(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := c(s, m.Memory().Peek) != 0; got != want {
+			t.Errorf("%s = %v, want %v", expr, got, want)
+		}
+	}
+}
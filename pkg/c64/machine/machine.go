@@ -0,0 +1,304 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jejer/commando64/pkg/c64"
+	"github.com/jejer/commando64/pkg/c64/cia"
+	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/irq"
+	"github.com/jejer/commando64/pkg/c64/memory"
+	"github.com/jejer/commando64/pkg/c64/peripheral/headless"
+	"github.com/jejer/commando64/pkg/c64/vic"
+)
+
+// Machine is a complete C64: the chips wired to one memory bus and driven by
+// one master clock.
+type Machine struct {
+	logger       slog.Logger
+	model        c64.Model
+	roms         *ROMSet
+	peripheralIO c64.PeripheralIO
+
+	// mu serializes Run with calls from other goroutines, e.g. frontend hotkeys
+	mu       sync.Mutex
+	irq      *irq.Controller
+	clock    *clock.Clock
+	throttle *clock.Throttle
+	rewind   *rewindBuffer
+	debug    *debugger // breakpoints, nil until one is set
+	cpu      *cpu.CPU
+	mem      *memory.C64MemoryBus
+	vic      *vic.VICII
+	cia1     *cia.CIA1
+	cia2     *cia.CIA2
+
+	// lifecycle of Run, guarded by runMu
+	runMu  sync.Mutex
+	stop   context.CancelFunc // stops the active Run, nil if not running
+	paused bool
+	resume chan struct{} // closed by Resume
+}
+
+func New(opts ...Option) (*Machine, error) {
+	m := &Machine{
+		logger: *slog.Default(),
+		model:  c64.ModelPAL,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.roms == nil {
+		return nil, errors.New("machine: no ROM set")
+	}
+	if err := m.roms.Validate(); err != nil {
+		return nil, fmt.Errorf("machine: %w", err)
+	}
+	if m.peripheralIO == nil {
+		m.peripheralIO = headless.NewPeripheralHeadless(m.logger)
+	}
+
+	m.irq = irq.NewController()
+	m.clock = clock.NewClock()
+	m.cia1 = cia.NewCIA1(m.logger, m.model, m.irq, m.peripheralIO)
+	m.cia2 = cia.NewCIA2(m.logger, m.model, m.irq)
+	m.mem = memory.NewC64Memory(m.logger, m.cia1, m.cia2, nil)
+	m.vic = vic.NewVICII(m.logger, m.clock, m.model, m.mem, m.irq, m.peripheralIO)
+	m.mem.SetVIC(m.vic)
+	m.cpu = cpu.NewCPU(m.logger, m.mem, m.irq)
+
+	m.clock.Attach(m.vic, m.cia1, m.cia2, m.mem.Port())
+	m.clock.AttachCPU(m.cpu)
+	m.throttle = clock.NewThrottle(m.model.ClockHz)
+
+	for _, rom := range []struct {
+		data []byte
+		addr uint16
+	}{
+		{m.roms.Basic, c64.BasicRomAddr},
+		{m.roms.Kernal, c64.KernalRomAddr},
+		{m.roms.Chars, c64.CharsRomAddr},
+	} {
+		if err := m.mem.LoadRomData(rom.data, rom.addr, false); err != nil {
+			return nil, fmt.Errorf("machine: %w", err)
+		}
+	}
+	m.logger.Info("ROMs",
+		"basic", IdentifyROM(m.roms.Basic, KnownBasics),
+		"kernal", m.roms.KernalName(),
+		"characters", IdentifyROM(m.roms.Chars, KnownChars))
+	m.Reset()
+	return m, nil
+}
+
+// Reset pulls the RESET line: it resets the CIAs, banks in the ROMs and
+// restarts the CPU from the reset vector.
+func (m *Machine) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cia1.Reset()
+	m.cia2.Reset()
+	m.irq.Reset()
+	m.mem.Reset()
+	m.cpu.Reset()
+}
+
+// Run drives the machine at the speed set by SetSpeed, real time by default,
+// until ctx is done, Stop is called or the CPU halts. It returns ctx.Err()
+// if ctx is done, nil after Stop and the CPU error if the CPU halts.
+func (m *Machine) Run(ctx context.Context) error {
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	m.runMu.Lock()
+	if m.stop != nil {
+		m.runMu.Unlock()
+		return errors.New("machine: already running")
+	}
+	m.stop = stop
+	m.runMu.Unlock()
+	defer func() {
+		m.runMu.Lock()
+		m.stop = nil
+		m.runMu.Unlock()
+	}()
+
+	m.throttle.Measure(m.clock.Cycles())
+	lastMeasure := time.Now()
+	for {
+		if resume := m.pauseCh(); resume != nil {
+			select {
+			case <-resume:
+				m.throttle.Reset(m.clock.Cycles())
+				continue
+			case <-runCtx.Done():
+			}
+		}
+		if runCtx.Err() != nil {
+			return ctx.Err()
+		}
+		m.StepFrame()
+		if err := m.cpu.Err(); err != nil {
+			return err
+		}
+		m.throttle.Sync(m.clock.Cycles())
+		if now := time.Now(); now.After(lastMeasure.Add(10 * time.Second)) {
+			m.logger.Info("Speed", "percent", int(m.throttle.Measure(m.clock.Cycles())), "target", m.throttle.Speed())
+			lastMeasure = now
+		}
+	}
+}
+
+// Stop makes the active Run return, it is a no-op if the machine is not running.
+func (m *Machine) Stop() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.stop != nil {
+		m.stop()
+	}
+}
+
+// Pause suspends Run after the current frame until Resume is called.
+func (m *Machine) Pause() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if !m.paused {
+		m.paused = true
+		m.resume = make(chan struct{})
+	}
+}
+
+func (m *Machine) Resume() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.paused {
+		m.paused = false
+		close(m.resume)
+	}
+}
+
+func (m *Machine) Paused() bool {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	return m.paused
+}
+
+// pauseCh returns the channel closed on Resume, nil if not paused.
+func (m *Machine) pauseCh() chan struct{} {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if !m.paused {
+		return nil
+	}
+	return m.resume
+}
+
+// SetSpeed sets the speed of Run in percent of real time, from
+// clock.MinSpeed to clock.MaxSpeed, or clock.Warp to run unthrottled.
+func (m *Machine) SetSpeed(percent int) {
+	m.throttle.SetSpeed(percent)
+	m.logger.Info("SetSpeed", "percent", m.throttle.Speed())
+}
+
+func (m *Machine) Speed() int {
+	return m.throttle.Speed()
+}
+
+// StepCycle advances the machine by one cycle.
+func (m *Machine) StepCycle() {
+	m.mu.Lock()
+	m.step()
+	b, fn := m.takeBreak()
+	m.mu.Unlock()
+	m.notifyBreak(b, fn)
+}
+
+// StepInstruction runs the machine until the CPU has finished one
+// instruction or a breakpoint stops it.
+func (m *Machine) StepInstruction() {
+	m.mu.Lock()
+	m.stepInstruction()
+	b, fn := m.takeBreak()
+	m.mu.Unlock()
+	m.notifyBreak(b, fn)
+}
+
+func (m *Machine) stepInstruction() {
+	for m.cpu.InstructionDone() && m.cpu.Err() == nil {
+		if m.step() {
+			return
+		}
+	}
+	for !m.cpu.InstructionDone() {
+		if m.step() {
+			return
+		}
+	}
+}
+
+// StepFrame runs the machine until the VIC has completed a frame or a
+// breakpoint stops it, and records the frame in the rewind buffer if
+// enabled.
+func (m *Machine) StepFrame() {
+	m.mu.Lock()
+	frame := m.vic.Frame()
+	for m.vic.Frame() == frame {
+		if m.step() {
+			break
+		}
+	}
+	if m.rewind != nil && m.vic.Frame() != frame {
+		m.recordRewind()
+	}
+	b, fn := m.takeBreak()
+	m.mu.Unlock()
+	m.notifyBreak(b, fn)
+}
+
+// SetTracer sets the tracer of the CPU, nil removes it.
+func (m *Machine) SetTracer(t cpu.Tracer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cpu.SetTracer(t)
+}
+
+// Cycles returns the number of cycles run so far, safe to call while Run is active.
+func (m *Machine) Cycles() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock.Cycles()
+}
+
+// FrameRate returns the frames per second of the machine model.
+func (m *Machine) FrameRate() float64 {
+	return float64(m.model.ClockHz) / float64(m.model.Lines*m.model.LineCycles)
+}
+
+func (m *Machine) Clock() *clock.Clock {
+	return m.clock
+}
+
+func (m *Machine) CPU() *cpu.CPU {
+	return m.cpu
+}
+
+func (m *Machine) Memory() *memory.C64MemoryBus {
+	return m.mem
+}
+
+func (m *Machine) VIC() *vic.VICII {
+	return m.vic
+}
+
+func (m *Machine) CIA1() *cia.CIA1 {
+	return m.cia1
+}
+
+func (m *Machine) CIA2() *cia.CIA2 {
+	return m.cia2
+}
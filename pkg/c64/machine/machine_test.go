@@ -0,0 +1,197 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jejer/commando64/pkg/c64"
+	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/peripheral/headless"
+)
+
+const bootFrames = 150 // 3 seconds, the KERNAL is at READY by then
+
+func newTestMachine(t testing.TB, opts ...Option) (*Machine, *headless.PeripheralHeadless) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	roms, err := LoadROMSet("../../../test/roms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := headless.NewPeripheralHeadless(*logger)
+	m, err := New(append([]Option{WithLogger(*logger), WithROMSet(roms), WithPeripheral(p)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, p
+}
+
+// screen codes of "READY."
+var ready = []byte{18, 5, 1, 4, 25, 46}
+
+func TestBoot(t *testing.T) {
+	for _, model := range c64.Models {
+		t.Run(model.Name, func(t *testing.T) {
+			testBoot(t, model)
+		})
+	}
+}
+
+func testBoot(t *testing.T, model c64.Model) {
+	m, io := newTestMachine(t, WithModel(model))
+	for i := 0; i < bootFrames; i++ {
+		m.StepFrame()
+	}
+	if io.Refreshes() != bootFrames {
+		t.Errorf("refreshes = %d, want %d", io.Refreshes(), bootFrames)
+	}
+
+	var screen [1000]byte
+	for i := range screen {
+		screen[i] = m.Memory().Read(0x0400 + uint16(i))
+	}
+	if !bytes.Contains(screen[:], ready) {
+		t.Errorf("READY. not on screen after %d frames", bootFrames)
+	}
+
+	// the KERNAL tells PAL from NTSC by the number of raster lines
+	if pal := m.Memory().Read(0x02a6) == 1; pal != (model == c64.ModelPAL) {
+		t.Errorf("KERNAL detected PAL = %v", pal)
+	}
+
+	frame := io.Frame().(*image.Paletted)
+	if border := frame.ColorIndexAt(0, 0); border != 14 {
+		t.Errorf("border color = %d, want 14", border)
+	}
+	if background := frame.ColorIndexAt(200, 200); background != 6 {
+		t.Errorf("background color = %d, want 6", background)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	m1, io1 := newTestMachine(t)
+	m2, io2 := newTestMachine(t)
+	for i := 0; i < bootFrames; i++ {
+		m1.StepFrame()
+		m2.StepFrame()
+	}
+	if !bytes.Equal(io1.Frame().(*image.Paletted).Pix, io2.Frame().(*image.Paletted).Pix) {
+		t.Error("two runs produced different frames")
+	}
+	if m1.Clock().Cycles() != m2.Clock().Cycles() {
+		t.Errorf("cycles differ: %d != %d", m1.Clock().Cycles(), m2.Clock().Cycles())
+	}
+}
+
+func TestResetCIAs(t *testing.T) {
+	m, _ := newTestMachine(t)
+	for i := 0; i < 10; i++ {
+		m.StepFrame()
+	}
+	// the KERNAL runs CIA1 timer A, wait for its interrupt with I set
+	s := m.CPU().State()
+	s.P |= cpu.FlagI
+	m.CPU().SetState(s)
+	for i := 0; i < 20000 && !m.irq.IRQ(); i++ {
+		m.StepCycle()
+	}
+	if !m.irq.IRQ() {
+		t.Fatal("no CIA1 timer interrupt")
+	}
+
+	m.Reset()
+	if m.irq.IRQ() || m.CIA1().Read(0xdc0e)&0x01 != 0 {
+		t.Errorf("CIA1 timer A still running after reset, IRQ %v", m.irq.IRQ())
+	}
+	// the KERNAL starts the timer again in IOINIT
+	for i := 0; i < 100; i++ {
+		if m.StepCycle(); m.irq.IRQ() {
+			t.Fatalf("IRQ asserted %d cycles after reset", i)
+		}
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	m, _ := newTestMachine(t)
+	m.SetSpeed(clock.Warp)
+	done := make(chan error, 1)
+
+	// a paused machine does not run until it is resumed
+	m.Pause()
+	start := m.Cycles()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- m.Run(ctx)
+	}()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run after cancel = %v, want %v", err, context.Canceled)
+	}
+	if m.Cycles() != start {
+		t.Error("machine runs while paused")
+	}
+
+	go func() {
+		done <- m.Run(context.Background())
+	}()
+	m.Resume()
+	waitCycles(t, m, start)
+
+	// Run stops at the end of the frame in progress
+	m.Pause()
+	paused := m.Cycles()
+	m.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Run after Stop = %v, want nil", err)
+	}
+	if frame := uint64(m.model.Lines * m.model.LineCycles); m.Cycles()-paused > frame {
+		t.Errorf("machine ran %d cycles after Pause, a frame is %d", m.Cycles()-paused, frame)
+	}
+}
+
+// waitCycles waits until the clock of a running machine passes from.
+func waitCycles(t *testing.T, m *Machine, from uint64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for m.Cycles() <= from {
+		if time.Now().After(deadline) {
+			t.Fatal("machine does not run after resume")
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestRunCPUHalt(t *testing.T) {
+	m, _ := newTestMachine(t)
+	m.SetSpeed(clock.Warp)
+	m.Memory().Write(0xc000, 0x02) // JAM
+	m.StepInstruction()            // finish the reset sequence
+	s := m.CPU().State()
+	s.PC = 0xc000
+	m.CPU().SetState(s)
+	err := m.Run(context.Background())
+	var jam *cpu.JamError
+	if !errors.As(err, &jam) || jam.State.PC != 0xc000 {
+		t.Errorf("Run on a halted CPU: err = %v", err)
+	}
+}
+
+// BenchmarkFrame runs the machine frame by frame from power on, the MHz are
+// emulated cycles per second. The real machine runs at about 1 MHz.
+func BenchmarkFrame(b *testing.B) {
+	m, _ := newTestMachine(b)
+	start := m.Cycles()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.StepFrame()
+	}
+	b.ReportMetric(float64(m.Cycles()-start)/b.Elapsed().Seconds()/1e6, "MHz")
+}
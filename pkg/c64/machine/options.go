@@ -0,0 +1,37 @@
+package machine
+
+import (
+	"log/slog"
+
+	"github.com/jejer/commando64/pkg/c64"
+)
+
+type Option func(m *Machine)
+
+// WithROMSet sets the BASIC, KERNAL and character ROMs.
+func WithROMSet(roms ROMSet) Option {
+	return func(m *Machine) {
+		m.roms = &roms
+	}
+}
+
+// WithPeripheral sets the screen and keyboard frontend, headless by default.
+func WithPeripheral(io c64.PeripheralIO) Option {
+	return func(m *Machine) {
+		m.peripheralIO = io
+	}
+}
+
+// WithModel sets the machine model, c64.ModelPAL by default.
+func WithModel(model c64.Model) Option {
+	return func(m *Machine) {
+		m.model = model
+	}
+}
+
+// WithLogger sets the logger shared by all chips, slog.Default() by default.
+func WithLogger(logger slog.Logger) Option {
+	return func(m *Machine) {
+		m.logger = logger
+	}
+}
@@ -0,0 +1,116 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// rewindBuffer is a ring of in-memory snapshots, one per frame. Only the
+// newest snapshot is kept in full, every older one is stored as a delta
+// against its successor, so going back is applying one delta per frame.
+type rewindBuffer struct {
+	frames int
+	latest []byte
+	deltas [][]byte // deltas[len-1] turns latest into the snapshot before it
+}
+
+func (r *rewindBuffer) push(snapshot []byte) {
+	if r.latest != nil {
+		r.deltas = append(r.deltas, xorDelta(snapshot, r.latest))
+		if len(r.deltas) >= r.frames {
+			r.deltas = r.deltas[1:]
+		}
+	}
+	r.latest = snapshot
+}
+
+// back drops the newest n snapshots, or as many as there are,
+// and returns the one before them.
+func (r *rewindBuffer) back(n int) []byte {
+	for ; n > 0 && len(r.deltas) > 0; n-- {
+		last := len(r.deltas) - 1
+		applyDelta(r.latest, r.deltas[last])
+		r.deltas = r.deltas[:last]
+	}
+	return r.latest
+}
+
+// xorDelta encodes b XOR a as runs: the uvarint length of a run of equal
+// bytes, the uvarint length of the following run of differing bytes, then
+// the differing bytes XORed. a and b have the same length.
+func xorDelta(a, b []byte) []byte {
+	var delta []byte
+	for i := 0; i < len(a); {
+		same := i
+		for same < len(a) && a[same] == b[same] {
+			same++
+		}
+		diff := same
+		for diff < len(a) && a[diff] != b[diff] {
+			diff++
+		}
+		delta = binary.AppendUvarint(delta, uint64(same-i))
+		delta = binary.AppendUvarint(delta, uint64(diff-same))
+		for j := same; j < diff; j++ {
+			delta = append(delta, a[j]^b[j])
+		}
+		i = diff
+	}
+	return delta
+}
+
+// applyDelta XORs a delta made by xorDelta into dst.
+func applyDelta(dst, delta []byte) {
+	i := 0
+	for len(delta) > 0 {
+		same, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		diff, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		i += int(same)
+		for j := 0; j < int(diff); j++ {
+			dst[i] ^= delta[j]
+			i++
+		}
+		delta = delta[diff:]
+	}
+}
+
+// EnableRewind starts recording a snapshot per frame, keeping the last
+// seconds of emulation. Zero disables rewinding and frees the buffer.
+func (m *Machine) EnableRewind(seconds int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if seconds <= 0 {
+		m.rewind = nil
+		return
+	}
+	m.rewind = &rewindBuffer{frames: int(math.Ceil(float64(seconds) * m.FrameRate()))}
+	m.recordRewind()
+}
+
+func (m *Machine) recordRewind() {
+	var buf bytes.Buffer
+	if err := m.saveState(&buf); err != nil {
+		m.logger.Error("Rewind snapshot failed", "err", err)
+		return
+	}
+	m.rewind.push(buf.Bytes())
+}
+
+// RewindFrames steps the machine back by n frames, or as far as recorded.
+func (m *Machine) RewindFrames(n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rewind == nil {
+		return errors.New("rewind: not enabled")
+	}
+	return m.loadState(bytes.NewReader(m.rewind.back(n)))
+}
+
+// RewindSeconds jumps the machine back by the given seconds, or as far as recorded.
+func (m *Machine) RewindSeconds(seconds float64) error {
+	return m.RewindFrames(int(math.Round(seconds * m.FrameRate())))
+}
@@ -0,0 +1,52 @@
+package machine
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestRewind(t *testing.T) {
+	m, io := newTestMachine(t)
+	m.EnableRewind(1)
+	for i := 0; i < 80; i++ {
+		m.StepFrame()
+	}
+	cycles := m.Clock().Cycles()
+	for i := 0; i < 10; i++ {
+		m.StepFrame()
+	}
+	want := io.Frame().(*image.Paletted).Pix
+
+	if err := m.RewindFrames(10); err != nil {
+		t.Fatal(err)
+	}
+	if m.Clock().Cycles() != cycles {
+		t.Fatalf("cycles after rewind = %d, want %d", m.Clock().Cycles(), cycles)
+	}
+	for i := 0; i < 10; i++ {
+		m.StepFrame()
+	}
+	if !bytes.Equal(io.Frame().(*image.Paletted).Pix, want) {
+		t.Error("replay after rewind produced a different frame")
+	}
+
+	// only one second is kept
+	if err := m.RewindSeconds(10); err != nil {
+		t.Fatal(err)
+	}
+	oldest := 90 - m.rewind.frames + 1
+	if frame := m.VIC().Frame(); frame != oldest {
+		t.Errorf("rewound to frame %d, want %d", frame, oldest)
+	}
+}
+
+func TestXorDelta(t *testing.T) {
+	a := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []byte{1, 2, 9, 9, 5, 6, 7, 0}
+	d := xorDelta(a, b)
+	applyDelta(b, d)
+	if !bytes.Equal(a, b) {
+		t.Errorf("got %v, want %v", b, a)
+	}
+}
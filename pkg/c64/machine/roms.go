@@ -0,0 +1,153 @@
+package machine
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ROMDirEnv names the environment variable that overrides the ROM directory.
+const ROMDirEnv = "C64_ROMS"
+
+const (
+	BasicROMSize  = 8192
+	KernalROMSize = 8192
+	CharsROMSize  = 4096
+)
+
+// ROMSet holds the contents of the three C64 ROMs.
+type ROMSet struct {
+	Basic  []byte
+	Kernal []byte
+	Chars  []byte
+}
+
+// KnownROM is a released ROM image identified by its checksums. An image
+// without SHA1 is identified by its CRC32 alone.
+type KnownROM struct {
+	Name  string
+	CRC32 uint32
+	SHA1  string
+}
+
+// https://www.zimmers.net/anonftp/pub/cbm/firmware/computers/c64/
+var (
+	KnownBasics = []KnownROM{
+		{"901226-01", 0xf833d117, "79015323128650c742a3694c9429aa91f355905e"},
+	}
+	KnownKernals = []KnownROM{
+		{"901227-01", 0xdce782fa, "87cc04d61fc748b82df09856847bb5c2754a2033"},
+		{"901227-02", 0xa5c687b3, "0e2e4ee3f2d41f00bed72f9ab588b83e306fdb13"},
+		{"901227-03", 0xdbe3e7c7, "1d503e56df85a62fee696e7618dc5b4e781df1bb"},
+		{"251104-04 (SX-64)", 0x2c5965d4, "aa136e91ecf3c5ac64f696b3dbcbfc5ba0871c98"},
+		// https://www.go4retro.com/products/jiffydos/
+		{"JiffyDOS 6.01", 0x2f79984c, ""},
+	}
+	KnownChars = []KnownROM{
+		{"901225-01", 0xec4272ee, "adc7c31e18c7c7413d54802ef2f4193da14711aa"},
+	}
+)
+
+// file names tried in a ROM directory, the stock names first
+var (
+	basicFiles  = []string{"basic.901226-01.bin", "basic.bin", "basic"}
+	kernalFiles = []string{"kernal.901227-03.bin", "kernal.bin", "kernal"}
+	charsFiles  = []string{"characters.901225-01.bin", "chargen.bin", "chargen", "characters.bin"}
+)
+
+// LoadROMSet reads and validates the ROM images in dir.
+func LoadROMSet(dir string) (ROMSet, error) {
+	roms, err := LoadROMSetFS(os.DirFS(dir))
+	if err != nil {
+		return roms, fmt.Errorf("%w in %s", err, dir)
+	}
+	return roms, nil
+}
+
+// LoadROMSetFS reads and validates the ROM images at the root of fsys.
+func LoadROMSetFS(fsys fs.FS) (ROMSet, error) {
+	var roms ROMSet
+	var err error
+	if roms.Basic, err = readROM(fsys, basicFiles); err != nil {
+		return roms, err
+	}
+	if roms.Kernal, err = readROM(fsys, kernalFiles); err != nil {
+		return roms, err
+	}
+	if roms.Chars, err = readROM(fsys, charsFiles); err != nil {
+		return roms, err
+	}
+	return roms, roms.Validate()
+}
+
+func readROM(fsys fs.FS, names []string) ([]byte, error) {
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("rom: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("rom: %s not found", names[0])
+}
+
+// FindROMDir returns the ROM directory named by $C64_ROMS, or else the
+// commando64/roms directory in the user config directory if it exists.
+func FindROMDir() (string, bool) {
+	if dir := os.Getenv(ROMDirEnv); dir != "" {
+		return dir, true
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.Join(config, "commando64", "roms")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// Validate checks the ROM sizes. Unknown images of the right size are
+// accepted, custom KERNALs are common.
+func (roms ROMSet) Validate() error {
+	for _, r := range []struct {
+		name string
+		data []byte
+		size int
+	}{
+		{"basic", roms.Basic, BasicROMSize},
+		{"kernal", roms.Kernal, KernalROMSize},
+		{"characters", roms.Chars, CharsROMSize},
+	} {
+		if len(r.data) != r.size {
+			return fmt.Errorf("rom: %s is %d bytes, want %d", r.name, len(r.data), r.size)
+		}
+	}
+	return nil
+}
+
+// KernalName identifies the KERNAL revision, see IdentifyROM.
+func (roms ROMSet) KernalName() string {
+	return IdentifyROM(roms.Kernal, KnownKernals)
+}
+
+// IdentifyROM returns the name of the known image matching data, or a
+// description with the checksum if there is none.
+func IdentifyROM(data []byte, known []KnownROM) string {
+	crc := crc32.ChecksumIEEE(data)
+	sum := sha1.Sum(data)
+	for _, k := range known {
+		if k.CRC32 == crc && (k.SHA1 == "" || k.SHA1 == hex.EncodeToString(sum[:])) {
+			return k.Name
+		}
+	}
+	return fmt.Sprintf("unknown (CRC32 %08x)", crc)
+}
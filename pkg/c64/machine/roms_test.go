@@ -0,0 +1,53 @@
+package machine
+
+import (
+	"hash/crc32"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadROMSet(t *testing.T) {
+	roms, err := LoadROMSet("../../../test/roms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := roms.KernalName(); name != "901227-03" {
+		t.Errorf("kernal = %q, want 901227-03", name)
+	}
+	if name := IdentifyROM(roms.Chars, KnownChars); name != "901225-01" {
+		t.Errorf("characters = %q, want 901225-01", name)
+	}
+
+	// a custom KERNAL under a generic name is accepted
+	fsys := fstest.MapFS{
+		"basic.bin":   {Data: roms.Basic},
+		"kernal.bin":  {Data: make([]byte, KernalROMSize)},
+		"chargen.bin": {Data: roms.Chars},
+	}
+	custom, err := LoadROMSetFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := custom.KernalName(); !strings.HasPrefix(name, "unknown") {
+		t.Errorf("custom kernal = %q, want unknown", name)
+	}
+	// a banner is no proof of the revision
+	copy(custom.Kernal, "JIFFYDOS")
+	if name := custom.KernalName(); !strings.HasPrefix(name, "unknown") {
+		t.Errorf("kernal with a JiffyDOS banner = %q, want unknown", name)
+	}
+	known := []KnownROM{{"no SHA1", crc32.ChecksumIEEE(custom.Kernal), ""}}
+	if name := IdentifyROM(custom.Kernal, known); name != "no SHA1" {
+		t.Errorf("kernal = %q, want a match on the CRC32", name)
+	}
+
+	fsys["kernal.bin"] = &fstest.MapFile{Data: roms.Kernal[:4096]}
+	if _, err := LoadROMSetFS(fsys); err == nil || !strings.Contains(err.Error(), "kernal is 4096 bytes") {
+		t.Errorf("truncated kernal: err = %v", err)
+	}
+	delete(fsys, "kernal.bin")
+	if _, err := LoadROMSetFS(fsys); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing kernal: err = %v", err)
+	}
+}
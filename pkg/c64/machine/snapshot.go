@@ -0,0 +1,150 @@
+package machine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jejer/commando64/pkg/c64/cia"
+	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/irq"
+	"github.com/jejer/commando64/pkg/c64/memory"
+	"github.com/jejer/commando64/pkg/c64/vic"
+)
+
+// Snapshot file layout, all values little endian:
+//
+//	header   magic "C64SNAP\0", format version, model name
+//	machine  clock, CPU, VIC, CIA1 and CIA2 state, interrupt lines, CPU port
+//	memory   64K RAM, 64K ROM
+//
+// The version must be bumped whenever any of the State structs change.
+const SnapshotVersion = 6
+
+var snapshotMagic = [8]byte{'C', '6', '4', 'S', 'N', 'A', 'P', 0}
+
+type snapshotHeader struct {
+	Magic   [8]byte
+	Version uint16
+	Model   [16]byte
+}
+
+type snapshotState struct {
+	Clock clock.State
+	CPU   cpu.State
+	VIC   vic.State
+	CIA1  cia.State
+	CIA2  cia.State
+	IRQ   irq.State
+	Port  memory.CPUPortState
+}
+
+func (m *Machine) snapshotHeader() snapshotHeader {
+	h := snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion}
+	copy(h.Model[:], m.model.Name)
+	return h
+}
+
+// SaveState writes a snapshot of the whole machine to w.
+func (m *Machine) SaveState(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveState(w)
+}
+
+func (m *Machine) saveState(w io.Writer) error {
+	s := snapshotState{
+		Clock: m.clock.State(),
+		CPU:   m.cpu.State(),
+		VIC:   m.vic.State(),
+		CIA1:  m.cia1.State(),
+		CIA2:  m.cia2.State(),
+		IRQ:   m.irq.State(),
+	}
+
+	mem := m.mem.State()
+	s.Port = mem.Port
+	for _, v := range []any{m.snapshotHeader(), &s, mem.RAM[:], mem.ROM[:]} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadState restores a snapshot written by SaveState. The machine is left
+// untouched if the snapshot is incompatible or truncated.
+func (m *Machine) LoadState(r io.Reader) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loadState(r)
+}
+
+func (m *Machine) loadState(r io.Reader) error {
+	var h snapshotHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if h.Magic != snapshotMagic {
+		return fmt.Errorf("snapshot: not a snapshot file")
+	}
+	if h.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot: version %d, want %d", h.Version, SnapshotVersion)
+	}
+	if want := m.snapshotHeader().Model; h.Model != want {
+		return fmt.Errorf("snapshot: taken on a %s machine, this is %s", cstring(h.Model[:]), m.model.Name)
+	}
+
+	var s snapshotState
+	var mem memory.State
+	for _, v := range []any{&s, mem.RAM[:], mem.ROM[:]} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+	}
+
+	m.clock.SetState(s.Clock)
+	m.cpu.SetState(s.CPU)
+	mem.Port = s.Port
+	m.mem.SetState(mem)
+	m.vic.SetState(s.VIC)
+	m.cia1.SetState(s.CIA1)
+	m.cia2.SetState(s.CIA2)
+	m.irq.SetState(s.IRQ)
+	m.throttle.Reset(m.clock.Cycles())
+	return nil
+}
+
+// SaveStateFile writes a snapshot to the file at path.
+func (m *Machine) SaveStateFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadStateFile restores a snapshot from the file at path.
+func (m *Machine) LoadStateFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.LoadState(f)
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,63 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	m, io := newTestMachine(t)
+	for i := 0; i < 100; i++ {
+		m.StepFrame()
+	}
+	var buf bytes.Buffer
+	if err := m.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	for i := 0; i < 50; i++ {
+		m.StepFrame()
+	}
+	want := io.Frame().(*image.Paletted).Pix
+	cycles := m.Clock().Cycles()
+
+	// restore into a fresh machine and replay the same 50 frames
+	m2, io2 := newTestMachine(t)
+	if err := m2.LoadState(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		m2.StepFrame()
+	}
+	if !bytes.Equal(io2.Frame().(*image.Paletted).Pix, want) {
+		t.Error("restored machine produced a different frame")
+	}
+	if m2.Clock().Cycles() != cycles {
+		t.Errorf("cycles = %d, want %d", m2.Clock().Cycles(), cycles)
+	}
+}
+
+func TestSnapshotIncompatible(t *testing.T) {
+	m, _ := newTestMachine(t)
+	var buf bytes.Buffer
+	if err := m.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+	pc := m.CPU().State().PC
+
+	bad := bytes.Clone(snapshot)
+	binary.LittleEndian.PutUint16(bad[8:], SnapshotVersion+1)
+	if err := m.LoadState(bytes.NewReader(bad)); err == nil {
+		t.Error("loaded a snapshot with a newer version")
+	}
+	if err := m.LoadState(bytes.NewReader(snapshot[:len(snapshot)/2])); err == nil {
+		t.Error("loaded a truncated snapshot")
+	}
+	if m.CPU().State().PC != pc {
+		t.Error("failed load modified the machine")
+	}
+}
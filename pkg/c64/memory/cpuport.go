@@ -0,0 +1,129 @@
+package memory
+
+// The 6510 has an 8 bit I/O port at $00 (data direction, 1 = output) and $01
+// (data). On the C64 the pins are wired to:
+//
+//	bit 0-2  LORAM, HIRAM, CHAREN, pulled up
+//	bit 3    cassette write line
+//	bit 4    cassette switch sense, pulled up, 0 while a button is pressed
+//	bit 5    cassette motor control, 0 = motor on
+//	bit 6-7  not connected
+//
+// A pin switched to input keeps the level it drove last unless it is pulled
+// up. Bits 6 and 7 have no pull-up, their charge fades away after a while,
+// which some loaders and protection checks test for.
+// https://www.c64-wiki.com/wiki/Zeropage
+// https://sourceforge.net/p/vice-emu/code/HEAD/tree/trunk/vice/src/c64/c64pla.c
+
+const (
+	CpuPortDirection uint16 = 0x0000
+
+	CassetteWrite byte = 1 << 3
+	CassetteSense byte = 1 << 4
+	CassetteMotor byte = 1 << 5
+
+	cpuPortPullUps  byte = LORAM | HIRAM | CHAREN | CassetteSense
+	cpuPortFloating byte = 0xc0 // bits 6 and 7
+
+	// CPUPortDecayCycles is the time an unconnected bit keeps reading its last
+	// output level after it was switched to input, about 350 ms.
+	CPUPortDecayCycles = 350000
+)
+
+type CPUPort struct {
+	dir    byte
+	data   byte
+	out    byte      // level last driven on each pin
+	charge byte      // level held by the floating bits 6 and 7
+	decay  [2]uint32 // cycles until bit 6 and 7 lose their charge
+	sense  bool      // a cassette button is pressed
+}
+
+// CPUPortState is the port state captured in machine snapshots.
+type CPUPortState struct {
+	Dir, Data, Out, Charge byte
+	Decay                  [2]uint32
+	Sense                  bool
+}
+
+func (p *CPUPort) State() CPUPortState {
+	return CPUPortState{Dir: p.dir, Data: p.data, Out: p.out, Charge: p.charge, Decay: p.decay, Sense: p.sense}
+}
+
+func (p *CPUPort) SetState(s CPUPortState) {
+	p.dir, p.data, p.out, p.charge = s.Dir, s.Data, s.Out, s.Charge
+	p.decay = s.Decay
+	p.sense = s.Sense
+}
+
+// Reset switches all pins to input, as the 6510 does on reset.
+func (p *CPUPort) Reset() {
+	p.data = 0
+	p.Write(CpuPortDirection, 0)
+}
+
+// Tick advances the decay of the floating bits by one cycle.
+func (p *CPUPort) Tick() {
+	for i := range p.decay {
+		if p.decay[i] == 0 {
+			continue
+		}
+		if p.decay[i]--; p.decay[i] == 0 {
+			p.charge &^= 0x40 << i
+		}
+	}
+}
+
+func (p *CPUPort) Read(addr uint16) byte {
+	if addr == CpuPortDirection {
+		return p.dir
+	}
+	v := (p.data | ^p.dir) & (p.out | cpuPortPullUps)
+	if p.dir&CassetteMotor == 0 {
+		v &^= CassetteMotor
+	}
+	if p.sense && p.dir&CassetteSense == 0 {
+		v &^= CassetteSense
+	}
+	input := cpuPortFloating &^ p.dir
+	return v&^input | p.charge&input
+}
+
+func (p *CPUPort) Write(addr uint16, v byte) {
+	if addr == CpuPortDirection {
+		// the floating bits switched to input start to lose their charge
+		for i := range p.decay {
+			bit := byte(0x40) << i
+			if p.dir&bit != 0 && v&bit == 0 {
+				p.decay[i] = CPUPortDecayCycles
+			} else if v&bit != 0 {
+				p.decay[i] = 0
+			}
+		}
+		p.dir = v
+	} else {
+		p.data = v
+	}
+	p.out = p.out&^p.dir | p.data&p.dir
+	p.charge = p.charge&^(cpuPortFloating&p.dir) | p.data&cpuPortFloating&p.dir
+}
+
+// Banking returns the LORAM, HIRAM and CHAREN lines, inputs are pulled up.
+func (p *CPUPort) Banking() byte {
+	return (p.data | ^p.dir) & (LORAM | HIRAM | CHAREN)
+}
+
+// SetCassetteSense sets whether a button on the cassette unit is pressed.
+func (p *CPUPort) SetCassetteSense(pressed bool) {
+	p.sense = pressed
+}
+
+// CassetteMotor reports whether the cassette motor is switched on.
+func (p *CPUPort) CassetteMotor() bool {
+	return p.dir&p.data&CassetteMotor == 0
+}
+
+// CassetteWrite returns the level of the cassette write line.
+func (p *CPUPort) CassetteWrite() bool {
+	return p.out&CassetteWrite != 0
+}
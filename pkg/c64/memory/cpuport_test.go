@@ -0,0 +1,63 @@
+package memory
+
+import "testing"
+
+func TestCPUPort(t *testing.T) {
+	var p CPUPort
+
+	// after reset every pin is an input, the pull-ups bank in the ROMs
+	p.Write(CpuPortRegister, 0x00)
+	if p.Banking() != LORAM|HIRAM|CHAREN {
+		t.Errorf("banking = %03b with all inputs, want 111", p.Banking())
+	}
+	if v := p.Read(CpuPortRegister); v != 0x17 {
+		t.Errorf("$01 = %02x with all inputs, want 17", v)
+	}
+
+	// the KERNAL setup, cassette motor off
+	p.Write(CpuPortDirection, 0x2f)
+	p.Write(CpuPortRegister, 0x37)
+	if v := p.Read(CpuPortRegister); v != 0x37 || p.CassetteMotor() {
+		t.Errorf("$01 = %02x motor %v, want 37 off", v, p.CassetteMotor())
+	}
+	p.SetCassetteSense(true)
+	if v := p.Read(CpuPortRegister); v != 0x27 {
+		t.Errorf("$01 = %02x with a cassette button pressed, want 27", v)
+	}
+
+	// bit 7 keeps its level for a while after it is switched to input
+	p.Write(CpuPortDirection, 0xef)
+	p.Write(CpuPortRegister, 0xb7)
+	p.Write(CpuPortDirection, 0x2f)
+	for i := 0; i < CPUPortDecayCycles-1; i++ {
+		p.Tick()
+	}
+	if v := p.Read(CpuPortRegister); v&0x80 == 0 {
+		t.Errorf("$01 = %02x, bit 7 decayed too early", v)
+	}
+	p.Tick()
+	if v := p.Read(CpuPortRegister); v&0x80 != 0 {
+		t.Errorf("$01 = %02x, bit 7 did not decay", v)
+	}
+
+	// a reset switches the bits to input like a write to $00 does
+	p.Write(CpuPortDirection, 0xef)
+	p.Write(CpuPortRegister, 0xb7)
+	p.Reset()
+	if v := p.Read(CpuPortRegister); v&0x80 == 0 {
+		t.Errorf("$01 = %02x after reset, bit 7 decayed too early", v)
+	}
+	for i := 0; i < CPUPortDecayCycles; i++ {
+		p.Tick()
+	}
+	if v := p.Read(CpuPortRegister); v&0x80 != 0 {
+		t.Errorf("$01 = %02x, bit 7 did not decay after reset", v)
+	}
+	p.Write(CpuPortDirection, 0x2f)
+
+	// outputs override the pull-ups in banking
+	p.Write(CpuPortRegister, 0x34)
+	if p.Banking() != CHAREN {
+		t.Errorf("banking = %03b, want 100", p.Banking())
+	}
+}
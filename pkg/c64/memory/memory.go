@@ -51,18 +51,45 @@ const BandModeIO BandMode = 0
 const BandModeRAM BandMode = 1
 const BandModeROM BandMode = 2
 
+// chip is what a page of the CPU address space maps to.
+type chip uint8
+
+const (
+	chipRAM chip = iota
+	chipROM
+	chipVIC
+	chipCIA1
+	chipCIA2
+)
+
 type C64MemoryBus struct {
 	ram    [65536]byte
 	rom    [65536]byte
+	port   CPUPort
 	cia1   c64.BasicIO
 	cia2   c64.BasicIO
 	vic    c64.BasicIO
+	hooks  []accessHook
+	hookID int
 	logger slog.Logger
+
+	// the chips the CPU reads and writes per page, for the banking lines
+	// they were built for
+	readMap, writeMap [256]chip
+	banking           byte
+}
+
+// State is the memory state captured in machine snapshots.
+type State struct {
+	RAM  [65536]byte
+	ROM  [65536]byte
+	Port CPUPortState
 }
 
 func NewC64Memory(logger slog.Logger, cia1, cia2, vic c64.BasicIO) *C64MemoryBus {
 	m := &C64MemoryBus{cia1: cia1, cia2: cia2, vic: vic}
 	m.logger = *logger.With("Component", "Memory")
+	m.remap()
 	return m
 }
 
@@ -70,29 +97,110 @@ func (m *C64MemoryBus) SetVIC(vic c64.BasicIO) {
 	m.vic = vic
 }
 
+func (m *C64MemoryBus) State() State {
+	return State{RAM: m.ram, ROM: m.rom, Port: m.port.State()}
+}
+
+func (m *C64MemoryBus) SetState(s State) {
+	m.ram = s.RAM
+	m.rom = s.ROM
+	m.port.SetState(s.Port)
+	m.remap()
+}
+
+// Port returns the 6510 I/O port at $00 and $01. Use Reset and Write rather
+// than changing the banking lines through it, the memory map would not
+// follow.
+func (m *C64MemoryBus) Port() *CPUPort {
+	return &m.port
+}
+
+// Reset resets the CPU port, which banks in the ROMs.
+func (m *C64MemoryBus) Reset() {
+	m.port.Reset()
+	m.remap()
+}
+
+// remap builds the memory map for the banking lines of the CPU port.
+// TODO: the cartridge GAME and EXROM lines, once there are cartridges.
+func (m *C64MemoryBus) remap() {
+	m.banking = m.port.Banking()
+	for i := range m.readMap {
+		page := uint16(i) << 8
+		read, write := chipRAM, chipRAM
+		switch m.GetAddrBandMode(page) {
+		case BandModeROM:
+			read = chipROM
+		case BandModeIO:
+			switch {
+			case page >= VICStartPage && page <= VICEndPage:
+				read, write = chipVIC, chipVIC
+			case page == CIA1Page:
+				read, write = chipCIA1, chipCIA1
+			case page == CIA2Page:
+				read, write = chipCIA2, chipCIA2
+			}
+		}
+		m.readMap[i], m.writeMap[i] = read, write
+	}
+}
+
+// AccessHook sees the CPU reads and writes, with the value read or written.
+type AccessHook func(addr uint16, v uint8, write bool)
+
+type accessHook struct {
+	id int
+	fn AccessHook
+}
+
+// AddAccessHook adds a hook and returns its id for RemoveAccessHook. VIC
+// fetches and Peek do not call the hooks.
+func (m *C64MemoryBus) AddAccessHook(h AccessHook) int {
+	m.hookID++
+	m.hooks = append(m.hooks, accessHook{m.hookID, h})
+	return m.hookID
+}
+
+// RemoveAccessHook removes the hook with id.
+func (m *C64MemoryBus) RemoveAccessHook(id int) {
+	for i, h := range m.hooks {
+		if h.id == id {
+			m.hooks = append(m.hooks[:i:i], m.hooks[i+1:]...)
+			return
+		}
+	}
+}
+
 func (m *C64MemoryBus) Write(addr uint16, v byte) {
+	for _, h := range m.hooks {
+		h.fn(addr, v, true)
+	}
+	m.Poke(addr, v)
+}
+
+// Poke writes as the CPU would without calling the hooks, for monitor
+// patches.
+func (m *C64MemoryBus) Poke(addr uint16, v byte) {
 	if addr == 0x04f0 && m.ram[0x0f0] != v {
 		m.logger.Info("0x04f0", "prev", m.ram[0x0f0], "new", v)
 	}
-	if CpuPortRegister == addr {
+	if addr <= CpuPortRegister {
+		// the write also reaches the RAM underneath
+		m.port.Write(addr, v)
 		m.ram[addr] = v
-		m.RomBankSwitch(v)
+		if m.port.Banking() != m.banking {
+			m.remap()
+		}
 		return
 	}
 
-	switch m.GetAddrBandMode(addr) {
-	case BandModeIO:
-		page := addr & 0xff00
-		switch {
-		case page >= VICStartPage && page <= VICEndPage:
-			m.vic.Write(addr, v)
-		case page == CIA1Page:
-			m.cia1.Write(addr, v)
-		case page == CIA2Page:
-			m.cia2.Write(addr, v)
-		default:
-			m.ram[addr] = v
-		}
+	switch m.writeMap[addr>>8] {
+	case chipVIC:
+		m.vic.Write(addr, v)
+	case chipCIA1:
+		m.cia1.Write(addr, v)
+	case chipCIA2:
+		m.cia2.Write(addr, v)
 	default:
 		// C64 always write to RAM even ROM is mounted.
 		m.ram[addr] = v
@@ -100,26 +208,55 @@ func (m *C64MemoryBus) Write(addr uint16, v byte) {
 }
 
 func (m *C64MemoryBus) Read(addr uint16) byte {
-	switch m.GetAddrBandMode(addr) {
-	case BandModeROM:
+	v := m.read(addr)
+	for _, h := range m.hooks {
+		h.fn(addr, v, false)
+	}
+	return v
+}
+
+func (m *C64MemoryBus) read(addr uint16) byte {
+	if addr <= CpuPortRegister {
+		return m.port.Read(addr)
+	}
+	switch m.readMap[addr>>8] {
+	case chipROM:
 		return m.rom[addr]
-	case BandModeIO:
-		page := addr & 0xff00
-		switch {
-		case page >= VICStartPage && page <= VICEndPage:
-			return m.vic.Read(addr)
-		case page == CIA1Page:
-			return m.cia1.Read(addr)
-		case page == CIA2Page:
-			return m.cia2.Read(addr)
-		default:
-			return m.ram[addr]
-		}
+	case chipVIC:
+		return m.vic.Read(addr)
+	case chipCIA1:
+		return m.cia1.Read(addr)
+	case chipCIA2:
+		return m.cia2.Read(addr)
 	default:
 		return m.ram[addr]
 	}
 }
 
+// Peeker is an I/O chip that can be read without side effects.
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
+
+// Peek reads what the CPU would read without side effects, for monitors and
+// tracers. The I/O chips are read through their Peek method if they have
+// one.
+func (m *C64MemoryBus) Peek(addr uint16) byte {
+	var chip c64.BasicIO
+	switch m.readMap[addr>>8] {
+	case chipVIC:
+		chip = m.vic
+	case chipCIA1:
+		chip = m.cia1
+	case chipCIA2:
+		chip = m.cia2
+	}
+	if p, ok := chip.(Peeker); ok {
+		return p.Peek(addr)
+	}
+	return m.read(addr)
+}
+
 func (m *C64MemoryBus) ReadRom(addr uint16) byte {
 	return m.rom[addr]
 }
@@ -128,13 +265,6 @@ func (m *C64MemoryBus) ReadWord(addr uint16) uint16 {
 	return uint16(m.Read(addr)) | (uint16(m.Read(addr+1)) << 8)
 }
 
-// https://web.archive.org/web/20230527235630/https://www.c64-wiki.com/wiki/Zeropage
-func (m *C64MemoryBus) RomBankSwitch(v byte) {
-	if v != m.ram[CpuPortRegister] {
-		m.logger.Info("RomBankSwitch", "data", fmt.Sprintf("%08b", v))
-	}
-}
-
 func (m *C64MemoryBus) LoadRom(path string, addr uint16, ram bool) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -148,11 +278,24 @@ func (m *C64MemoryBus) LoadRom(path string, addr uint16, ram bool) error {
 		return err
 	}
 
-	for i := 0; i < len(byteContent); i++ {
+	if err := m.LoadRomData(byteContent, addr, ram); err != nil {
+		m.logger.Error("LoadRom Can't load file", "path", path, "addr", fmt.Sprintf("%08x", addr), "err", err)
+		return err
+	}
+	return nil
+}
+
+// LoadRomData copies data to addr, either into RAM or into the ROM overlay.
+// Data that does not fit below $10000 is rejected instead of wrapping around.
+func (m *C64MemoryBus) LoadRomData(data []byte, addr uint16, ram bool) error {
+	if int(addr)+len(data) > len(m.ram) {
+		return fmt.Errorf("memory: %d bytes at $%04x overflow the address space", len(data), addr)
+	}
+	for i := 0; i < len(data); i++ {
 		if ram {
-			m.ram[addr+uint16(i)] = byteContent[i]
+			m.ram[addr+uint16(i)] = data[i]
 		} else {
-			m.rom[addr+uint16(i)] = byteContent[i]
+			m.rom[addr+uint16(i)] = data[i]
 		}
 	}
 	return nil
@@ -180,9 +323,10 @@ func (m *C64MemoryBus) GetAddrBandMode(addr uint16) BandMode {
 	// +---+---+-------------+-----------+------------+
 	// | 0 |000|     RAM     |    RAM    |    RAM     |
 	// +---+---+-------------+-----------+------------+
-	hiram := ((m.ram[CpuPortRegister] & HIRAM) != 0)   // kernal
-	loram := ((m.ram[CpuPortRegister] & LORAM) != 0)   // basic
-	charen := ((m.ram[CpuPortRegister] & CHAREN) != 0) // char
+	banking := m.port.Banking()
+	hiram := ((banking & HIRAM) != 0)   // kernal
+	loram := ((banking & LORAM) != 0)   // basic
+	charen := ((banking & CHAREN) != 0) // char
 
 	// TODO: support cartridge and expansion cards
 	page := addr & 0xff00
@@ -207,6 +351,12 @@ func (m *C64MemoryBus) GetAddrBandMode(addr uint16) BandMode {
 	return BandModeRAM
 }
 
+// VicColorRead reads the color RAM at addr in $d800-$dbff. The VIC has its
+// own lines to the color RAM, the CPU banking and the hooks do not apply.
+func (m *C64MemoryBus) VicColorRead(addr uint16) uint8 {
+	return m.ram[ColorRamStartPage|addr&0x03ff]
+}
+
 func (m *C64MemoryBus) VicRead(addr uint16) uint8 {
 	// %00, 0: Bank 3: $C000-$FFFF, 49152-65535
 	// %01, 1: Bank 2: $8000-$BFFF, 32768-49151
@@ -220,5 +370,5 @@ func (m *C64MemoryBus) VicRead(addr uint16) uint8 {
 	if (addr >= 0x1000 && addr < 0x2000) || (addr >= 0x9000 && addr < 0xa000) {
 		return m.ReadRom(c64.CharsRomAddr + (addr & 0x0fff))
 	}
-	return m.Read(addr)
+	return m.read(addr)
 }
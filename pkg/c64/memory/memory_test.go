@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"log/slog"
+	"testing"
+)
+
+// chipIO stands for an I/O chip, it reads its id.
+type chipIO uint8
+
+func (c chipIO) Read(addr uint16) byte     { return byte(c) }
+func (c chipIO) Write(addr uint16, v byte) {}
+
+// peekIO tells peeks from reads.
+type peekIO struct{ reads int }
+
+func (c *peekIO) Read(addr uint16) byte     { c.reads++; return 1 }
+func (c *peekIO) Write(addr uint16, v byte) {}
+func (c *peekIO) Peek(addr uint16) byte     { return 2 }
+
+func TestBanking(t *testing.T) {
+	m := NewC64Memory(*slog.Default(), chipIO(0xc1), chipIO(0xc2), chipIO(0xd0))
+	for _, addr := range []uint16{0xa000, 0xd000, 0xdc00, 0xe000} {
+		m.LoadRomData([]byte{0xee}, addr, false)
+		m.LoadRomData([]byte{0x11}, addr, true)
+	}
+	const rom, ram = 0xee, 0x11
+	for _, tc := range []struct {
+		port                     byte
+		basic, vic, cia1, kernal byte
+	}{
+		{0x37, rom, 0xd0, 0xc1, rom},
+		{0x36, ram, 0xd0, 0xc1, rom},
+		{0x35, ram, 0xd0, 0xc1, ram},
+		{0x34, ram, ram, ram, ram},
+		{0x33, rom, rom, rom, rom},
+		{0x31, ram, rom, rom, ram},
+	} {
+		m.Write(CpuPortDirection, 0x2f)
+		m.Write(CpuPortRegister, tc.port)
+		got := [4]byte{m.Read(0xa000), m.Read(0xd000), m.Read(0xdc00), m.Read(0xe000)}
+		if want := [4]byte{tc.basic, tc.vic, tc.cia1, tc.kernal}; got != want {
+			t.Errorf("$01=%02x: % x, want % x", tc.port, got, want)
+		}
+	}
+
+	// the map follows the port through a restore and a reset
+	s := m.State()
+	m.Reset()
+	if v := m.Read(0xe000); v != rom {
+		t.Errorf("$e000 = %02x after reset, want the KERNAL", v)
+	}
+	m.SetState(s)
+	if v := m.Read(0xe000); v != ram {
+		t.Errorf("$e000 = %02x after restore, want RAM", v)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	cia1 := &peekIO{}
+	m := NewC64Memory(*slog.Default(), cia1, chipIO(0xc2), chipIO(0xd0))
+	if v := m.Peek(0xdc0d); v != 2 || cia1.reads != 0 {
+		t.Errorf("peek $dc0d = %d with %d reads, want the chip's Peek", v, cia1.reads)
+	}
+	if v := m.Peek(0xd020); v != 0xd0 {
+		t.Errorf("peek $d020 = %02x, want the VIC's Read", v)
+	}
+}
+
+func TestVicColorRead(t *testing.T) {
+	m := NewC64Memory(*slog.Default(), chipIO(0xc1), chipIO(0xc2), chipIO(0xd0))
+	m.LoadRomData([]byte{0xee}, 0xd800, false)
+	m.Write(0xd800, 0x05)
+	reads := 0
+	m.AddAccessHook(func(addr uint16, v uint8, write bool) { reads++ })
+	m.Write(CpuPortDirection, 0x2f)
+	for _, port := range []byte{0x37, 0x33} {
+		m.Write(CpuPortRegister, port)
+		if port == 0x33 && m.Read(0xd800) != 0xee {
+			t.Fatal("no char ROM at $d800")
+		}
+		reads = 0
+		if v := m.VicColorRead(0xd800); v != 0x05 || reads != 0 {
+			t.Errorf("$01=%02x: color RAM %02x with %d hooked reads", port, v, reads)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package c64
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model describes the video standard and timing of a C64.
+type Model struct {
+	Name       string
+	VIC        string // VIC-II revision
+	ClockHz    int    // CPU clock
+	Lines      int    // raster lines per frame
+	LineCycles int    // CPU cycles per raster line
+	PowerHz    int    // mains frequency, drives the CIA TOD clocks
+
+	// drawn raster lines, the same 403 pixels wide window is used on all models
+	FirstVisibleLine int
+	LastVisibleLine  int
+}
+
+var (
+	ModelPAL = Model{
+		Name:             "PAL",
+		VIC:              "6569",
+		ClockHz:          PALClockHz,
+		Lines:            ScreenLines,
+		LineCycles:       LineCycles,
+		PowerHz:          50,
+		FirstVisibleLine: ScreenFirstVisibleLine,
+		LastVisibleLine:  ScreenLastVisibleLine,
+	}
+	// the NTSC vertical blank ends on line 41, the lower border lines
+	// that wrap around to line 0 are not drawn
+	ModelNTSC = Model{
+		Name:             "NTSC",
+		VIC:              "6567R8",
+		ClockHz:          NTSCClockHz,
+		Lines:            263,
+		LineCycles:       65,
+		PowerHz:          60,
+		FirstVisibleLine: 41,
+		LastVisibleLine:  263,
+	}
+	ModelNTSCOld = Model{
+		Name:             "NTSC-OLD",
+		VIC:              "6567R56A",
+		ClockHz:          NTSCClockHz,
+		Lines:            262,
+		LineCycles:       64,
+		PowerHz:          60,
+		FirstVisibleLine: 41,
+		LastVisibleLine:  262,
+	}
+
+	Models = []Model{ModelPAL, ModelNTSC, ModelNTSCOld}
+)
+
+// ModelByName looks up one of the Models, case insensitive.
+func ModelByName(name string) (Model, error) {
+	for _, m := range Models {
+		if strings.EqualFold(m.Name, name) {
+			return m, nil
+		}
+	}
+	return Model{}, fmt.Errorf("unknown model %q", name)
+}
@@ -0,0 +1,108 @@
+// Package monitor is a line based machine code monitor with the commands of
+// the VICE monitor, addresses are hex with an optional $:
+//
+//	a c000 lda #$01   assemble a line at $c000
+//	a sta $d020       assemble after the last line
+//	d c000            disassemble 10 instructions from $c000
+//	d                 disassemble on
+//
+// Lines starting with ; are comments.
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+// disassembleLines is the number of instructions d shows.
+const disassembleLines = 10
+
+// Monitor runs commands on a machine.
+type Monitor struct {
+	m    *machine.Machine
+	out  io.Writer
+	next uint16 // where a and d go on without an address
+}
+
+// New returns a monitor writing its output to out, it starts at the PC.
+func New(m *machine.Machine, out io.Writer) *Monitor {
+	return &Monitor{m: m, out: out, next: m.CPU().State().PC}
+}
+
+// Exec runs one command line.
+func (mon *Monitor) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, ";") {
+		return nil
+	}
+	cmd, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	switch strings.ToLower(cmd) {
+	case "a":
+		return mon.assemble(args)
+	case "d":
+		return mon.disassemble(args)
+	}
+	return fmt.Errorf("monitor: unknown command %q", cmd)
+}
+
+// Run runs the commands read from r, one per line, up to the first error.
+func (mon *Monitor) Run(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if err := mon.Exec(s.Text()); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return s.Err()
+}
+
+func (mon *Monitor) assemble(args string) error {
+	first, rest, _ := strings.Cut(args, " ")
+	if addr, ok := parseAddr(first); ok {
+		mon.next, args = addr, strings.TrimSpace(rest)
+	}
+	if args == "" {
+		return fmt.Errorf("monitor: nothing to assemble")
+	}
+	prog, err := mon.m.Assemble(mon.next, args)
+	if err != nil {
+		return err
+	}
+	mon.next = prog.End
+	return nil
+}
+
+func (mon *Monitor) disassemble(args string) error {
+	if args != "" {
+		addr, ok := parseAddr(args)
+		if !ok {
+			return fmt.Errorf("monitor: bad address %q", args)
+		}
+		mon.next = addr
+	}
+	for i := 0; i < disassembleLines; i++ {
+		l := disasm.Disassemble(mon.m.Memory().Peek, mon.next, nil)
+		fmt.Fprintln(mon.out, l)
+		mon.next += uint16(len(l.Bytes))
+	}
+	return nil
+}
+
+// parseAddr parses $ followed by hex, or 4 hex digits so that mnemonics such
+// as ADC do not pass for addresses.
+func parseAddr(s string) (uint16, bool) {
+	if hex, ok := strings.CutPrefix(s, "$"); ok {
+		s = hex
+	} else if len(s) != 4 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 16, 16)
+	return uint16(v), err == nil
+}
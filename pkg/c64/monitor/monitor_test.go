@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+)
+
+func TestAssemble(t *testing.T) {
+	m := machinetest.New(t)
+	writes := 0
+	m.AddAccessHook(func(addr uint16, v uint8, write bool) {
+		if write {
+			writes++
+		}
+	})
+	var out strings.Builder
+	mon := New(m, &out)
+	err := mon.Run(strings.NewReader(`
+; border color
+a c000 lda #$01
+a sta $d020
+a $c010 rts`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[uint16]uint8{
+		0xc000: 0xa9, 0xc001: 0x01, 0xc002: 0x8d, 0xc003: 0x20, 0xc004: 0xd0, 0xc010: 0x60,
+	} {
+		if v := m.Memory().Peek(addr); v != want {
+			t.Errorf("$%04x = %02x, want %02x", addr, v, want)
+		}
+	}
+	if writes != 0 {
+		t.Errorf("%d writes seen by the access hooks", writes)
+	}
+
+	if err := mon.Exec("d c000"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 11 || lines[0] != "c000  a9 01     LDA #$01" || lines[1] != "c002  8d 20 d0  STA $d020" {
+		t.Errorf("disassembly:\n%s", out.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mon := New(machinetest.New(t), &strings.Builder{})
+	for _, line := range []string{"a c000 foo", "a c000", "d zz", "x"} {
+		if err := mon.Exec(line); err == nil {
+			t.Errorf("%q accepted", line)
+		}
+	}
+	// a mnemonic made of hex digits is not an address
+	if err := mon.Exec("a adc #1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,94 @@
+package headless
+
+import (
+	"image"
+	"image/color"
+	"log/slog"
+	"sync"
+
+	"github.com/jejer/commando64/pkg/c64"
+)
+
+// PeripheralHeadless is a c64.PeripheralIO without a window, for CI machines
+// and tests. Frames are drawn into an in-memory framebuffer and the keyboard
+// matrix is set from code.
+type PeripheralHeadless struct {
+	logger slog.Logger
+
+	mu             sync.Mutex
+	pixels         [c64.ScreenVisibleWidth * c64.ScreenVisibleLines]uint8 // frame being drawn
+	frame          [c64.ScreenVisibleWidth * c64.ScreenVisibleLines]uint8 // last complete frame
+	refreshes      int
+	keyboardMetrix [8]uint8
+}
+
+func NewPeripheralHeadless(logger slog.Logger) *PeripheralHeadless {
+	p := &PeripheralHeadless{
+		logger: *logger.With("Component", "PeripheralHeadless"),
+	}
+	for i := range p.keyboardMetrix {
+		p.keyboardMetrix[i] = 0xff
+	}
+	return p
+}
+
+func (p *PeripheralHeadless) Init() {}
+
+// EventLoop returns immediately, there are no host events.
+func (p *PeripheralHeadless) EventLoop() {}
+
+func (p *PeripheralHeadless) ReadKeyboardMatrix(row uint8) uint8 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keyboardMetrix[row]
+}
+
+// SetKey presses or releases the key at row and col of the keyboard matrix.
+func (p *PeripheralHeadless) SetKey(row, col uint8, pressed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pressed {
+		p.keyboardMetrix[row] &^= 1 << col
+	} else {
+		p.keyboardMetrix[row] |= 1 << col
+	}
+}
+
+// SetKeyboardMatrix sets a whole row of the keyboard matrix, 0 bits are pressed keys.
+func (p *PeripheralHeadless) SetKeyboardMatrix(row, v uint8) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyboardMetrix[row] = v
+}
+
+func (p *PeripheralHeadless) SetFramePixel(x int, y uint16, color uint8) {
+	p.pixels[int(y)*c64.ScreenVisibleWidth+x] = color & 0x0f
+}
+
+func (p *PeripheralHeadless) RefreshScreen() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frame = p.pixels
+	p.refreshes++
+}
+
+// Refreshes returns the number of RefreshScreen calls, i.e. completed frames.
+func (p *PeripheralHeadless) Refreshes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.refreshes
+}
+
+// Frame returns a copy of the last complete frame.
+func (p *PeripheralHeadless) Frame() image.Image {
+	palette := make(color.Palette, len(c64.Palette))
+	for i, c := range c64.Palette {
+		palette[i] = color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: uint8(c >> 24)}
+	}
+	img := image.NewPaletted(image.Rect(0, 0, c64.ScreenVisibleWidth, c64.ScreenVisibleLines), palette)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	copy(img.Pix, p.frame[:])
+	return img
+}
@@ -14,7 +14,9 @@ type PeripheralSDL struct {
 	colors         [16]uint32
 	keyboardMetrix [8]uint8
 	keyboardIndex  map[uint32]uint8 // row: 0xf0, col: 0x0f
+	hotkeys        map[uint32]func()
 
+	window   *sdl.Window
 	renderer *sdl.Renderer
 	texture  *sdl.Texture
 	surface  *sdl.Surface
@@ -22,7 +24,8 @@ type PeripheralSDL struct {
 
 func NewPeripheralSDL(logger slog.Logger) *PeripheralSDL {
 	sdl := &PeripheralSDL{
-		logger: *logger.With("Component", "PeripheralSDL"),
+		logger:  *logger.With("Component", "PeripheralSDL"),
+		hotkeys: make(map[uint32]func()),
 	}
 	return sdl
 }
@@ -33,6 +36,12 @@ func (p *PeripheralSDL) Init() {
 	p.initVideo()
 }
 
+// BindKey binds a host key to a frontend action instead of the C64 keyboard,
+// fn is called from the event loop when the key is pressed.
+func (p *PeripheralSDL) BindKey(scancode uint32, fn func()) {
+	p.hotkeys[scancode] = fn
+}
+
 func (p *PeripheralSDL) EventLoop() {
 	running := true
 	for running {
@@ -43,7 +52,11 @@ func (p *PeripheralSDL) EventLoop() {
 				running = false
 			case *sdl.KeyboardEvent:
 				key := e.Keysym.Scancode
-				if e.Repeat > 0 {
+				if fn, ok := p.hotkeys[uint32(key)]; ok {
+					if e.State == sdl.PRESSED {
+						fn()
+					}
+				} else if e.Repeat > 0 {
 					p.logger.Info("key repeating", "key", key)
 				} else {
 					p.handleKey(uint32(e.Keysym.Scancode), e.State == sdl.PRESSED)
@@ -54,6 +67,15 @@ func (p *PeripheralSDL) EventLoop() {
 	}
 }
 
+// Close releases the window and SDL, the machine must not draw any more.
+func (p *PeripheralSDL) Close() {
+	p.texture.Destroy()
+	p.renderer.Destroy()
+	p.surface.Free()
+	p.window.Destroy()
+	sdl.Quit()
+}
+
 func (p *PeripheralSDL) handleKey(key uint32, pressed bool) {
 	if pos, ok := p.keyboardIndex[key]; ok {
 		row := pos >> 4
@@ -153,24 +175,7 @@ func (p *PeripheralSDL) initKeyboard() {
 }
 
 func (p *PeripheralSDL) initColor() {
-	p.colors = [16]uint32{
-		0xff000000,
-		0xffffffff,
-		0xffab3126,
-		0xff66daff,
-		0xffbb3fb8,
-		0xff55ce58,
-		0xff1d0e97,
-		0xffeaf57c,
-		0xffb97418,
-		0xff785300,
-		0xffdd9387,
-		0xff5b5b5b,
-		0xff8b8b8b,
-		0xffb0f4ac,
-		0xffaa9def,
-		0xffb8b8b8,
-	}
+	p.colors = c64.Palette
 }
 
 func (p *PeripheralSDL) initVideo() {
@@ -189,6 +194,7 @@ func (p *PeripheralSDL) initVideo() {
 		p.logger.Error("Window create failed")
 		panic(1)
 	}
+	p.window = window
 
 	// surface, err := window.GetSurface()
 	surface, err := sdl.CreateRGBSurface(0, c64.ScreenVisibleWidth, c64.ScreenVisibleLines, 32, 0, 0, 0, 0)
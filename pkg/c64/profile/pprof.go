@@ -0,0 +1,172 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// The pprof format is a gzipped protocol buffer, described in
+// https://github.com/google/pprof/blob/main/proto/profile.proto.
+// The few messages needed are encoded by hand.
+
+// Field numbers of the messages.
+const (
+	profileSampleType   = 1
+	profileSample       = 2
+	profileMapping      = 3
+	profileLocation     = 4
+	profileFunction     = 5
+	profileStringTable  = 6
+	profilePeriodType   = 11
+	profilePeriod       = 12
+	profileDefaultType  = 14
+	valueTypeType       = 1
+	valueTypeUnit       = 2
+	sampleLocationID    = 1
+	sampleValue         = 2
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFilename     = 5
+	mappingHasFunctions = 7
+	locationID          = 1
+	locationMappingID   = 2
+	locationAddress     = 3
+	locationLine        = 4
+	lineFunctionID      = 1
+	lineLine            = 2
+	functionID          = 1
+	functionName        = 2
+	functionSystemName  = 3
+	functionStartLine   = 5
+	wireVarint          = 0
+	wireLengthDelimited = 2
+)
+
+// message is a protocol buffer message being encoded.
+type message []byte
+
+func (m *message) varint(v uint64) {
+	for v >= 0x80 {
+		*m = append(*m, byte(v)|0x80)
+		v >>= 7
+	}
+	*m = append(*m, byte(v))
+}
+
+func (m *message) tag(field, wire int) {
+	m.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (m *message) uint(field int, v uint64) {
+	if v != 0 {
+		m.tag(field, wireVarint)
+		m.varint(v)
+	}
+}
+
+func (m *message) bytes(field int, b []byte) {
+	m.tag(field, wireLengthDelimited)
+	m.varint(uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *message) packed(field int, vs []uint64) {
+	var p message
+	for _, v := range vs {
+		p.varint(v)
+	}
+	m.bytes(field, p)
+}
+
+// stringTable is the string table, index 0 is the empty string.
+type stringTable struct {
+	list  []string
+	index map[string]int
+}
+
+func (t *stringTable) id(s string) uint64 {
+	if t.index == nil {
+		t.list, t.index = []string{""}, map[string]int{"": 0}
+	}
+	i, ok := t.index[s]
+	if !ok {
+		i = len(t.list)
+		t.list = append(t.list, s)
+		t.index[s] = i
+	}
+	return uint64(i)
+}
+
+// WritePprof writes the profile in the pprof format. The samples hold the
+// cycles and the number of instructions run, the functions are named by
+// Symbols and the line numbers are the addresses.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var strs stringTable
+	var prof message
+	for _, t := range [][2]string{{"cycles", "count"}, {"instructions", "count"}} {
+		var vt message
+		vt.uint(valueTypeType, strs.id(t[0]))
+		vt.uint(valueTypeUnit, strs.id(t[1]))
+		prof.bytes(profileSampleType, vt)
+	}
+
+	for _, s := range p.samples {
+		var sm message
+		ids := make([]uint64, len(s.locs))
+		for i, loc := range s.locs {
+			ids[i] = uint64(loc) + 1
+		}
+		sm.packed(sampleLocationID, ids)
+		sm.packed(sampleValue, []uint64{s.cycles, s.count})
+		prof.bytes(profileSample, sm)
+	}
+
+	var mapping message
+	mapping.uint(mappingID, 1)
+	mapping.uint(mappingMemoryStart, 0)
+	mapping.uint(mappingMemoryLimit, 0x10000)
+	mapping.uint(mappingFilename, strs.id("c64"))
+	mapping.uint(mappingHasFunctions, 1)
+	prof.bytes(profileMapping, mapping)
+
+	for i, l := range p.locations {
+		var line message
+		line.uint(lineFunctionID, uint64(l.fn)+1)
+		line.uint(lineLine, uint64(l.pc))
+		var loc message
+		loc.uint(locationID, uint64(i)+1)
+		loc.uint(locationMappingID, 1)
+		loc.uint(locationAddress, uint64(l.pc))
+		loc.bytes(locationLine, line)
+		prof.bytes(profileLocation, loc)
+	}
+
+	for i, f := range p.functions {
+		var fn message
+		name := strs.id(p.name(f))
+		fn.uint(functionID, uint64(i)+1)
+		fn.uint(functionName, name)
+		fn.uint(functionSystemName, name)
+		fn.uint(functionStartLine, uint64(f.entry))
+		prof.bytes(profileFunction, fn)
+	}
+
+	var period message
+	period.uint(valueTypeType, strs.id("cycles"))
+	period.uint(valueTypeUnit, strs.id("count"))
+	cycles := strs.id("cycles")
+	// the string table goes last, all strings are known by now
+	for _, s := range strs.list {
+		prof.bytes(profileStringTable, []byte(s))
+	}
+	prof.bytes(profilePeriodType, period)
+	prof.uint(profilePeriod, 1)
+	prof.uint(profileDefaultType, cycles)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(prof); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,333 @@
+// Package profile counts the cycles a machine spends per instruction address
+// and per subroutine, and writes them in the pprof format:
+//
+//	p := profile.New(m)
+//	m.SetTracer(p)
+//	... run the machine ...
+//	p.WritePprof(f)
+//
+//	go tool pprof -top c64.pprof
+//
+// The cycles are measured on the clock, so page crossings and the cycles
+// the VIC steals on bad lines count. Subroutines are followed through JSR
+// and RTS, interrupt handlers through the interrupt sequence and RTI. A
+// handler starts a call stack of its own, its cycles do not count for the
+// code it interrupted.
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+const (
+	opBRK = 0x00
+	opJSR = 0x20
+	opRTS = 0x60
+	opRTI = 0x40
+
+	// maxDepth bounds the call stack for code that leaves subroutines
+	// without RTS, the 6502 stack holds 128 return addresses.
+	maxDepth = 128
+)
+
+// Kind tells how a function was entered.
+type Kind uint8
+
+const (
+	TopLevel   Kind = iota // code not called through JSR, e.g. the main loop
+	Subroutine             // called through JSR
+	IRQ                    // IRQ or BRK handler
+	NMI                    // NMI handler
+)
+
+type function struct {
+	entry uint16
+	kind  Kind
+}
+
+// frame is a function on the call stack.
+type frame struct {
+	fn   int    // index in functions
+	call uint16 // address of the JSR, if a subroutine
+	ctx  int    // interned stack up to this frame
+}
+
+type ctxKey struct {
+	parent int // -1 at the root of a stack
+	fn     int
+	call   uint16
+}
+
+type sampleKey struct {
+	ctx int
+	pc  uint16
+}
+
+type location struct {
+	pc uint16
+	fn int
+}
+
+type sample struct {
+	locs   []int // indexes in locations, innermost first
+	cycles uint64
+	count  uint64
+}
+
+// Profiler is a cpu.Tracer collecting the profile.
+type Profiler struct {
+	// Symbols names the functions, by entry address.
+	Symbols disasm.Symbols
+
+	m       *machine.Machine
+	perPC   [0x10000]uint64
+	stack   []frame
+	lastOp  uint8
+	lastPC  uint16
+	last    *sample // charged with the cycles up to the next instruction
+	ran     bool    // the call or return of lastOp is still to be followed
+	lastCyc uint64
+	pending Kind   // an interrupt sequence started, TopLevel if none
+	carried uint64 // cycles of interrupt sequences, for the handler
+
+	functions []function
+	funcIndex map[function]int
+	calls     []uint64 // per function
+	locations []location
+	locIndex  map[location]int
+	contexts  map[ctxKey]int
+	samples   map[sampleKey]*sample
+}
+
+// New returns a profiler for m, attach it with m.SetTracer.
+func New(m *machine.Machine) *Profiler {
+	return &Profiler{
+		m:         m,
+		funcIndex: map[function]int{},
+		locIndex:  map[location]int{},
+		contexts:  map[ctxKey]int{},
+		samples:   map[sampleKey]*sample{},
+	}
+}
+
+func (p *Profiler) function(entry uint16, kind Kind) int {
+	f := function{entry, kind}
+	i, ok := p.funcIndex[f]
+	if !ok {
+		i = len(p.functions)
+		p.functions = append(p.functions, f)
+		p.calls = append(p.calls, 0)
+		p.funcIndex[f] = i
+	}
+	return i
+}
+
+func (p *Profiler) location(pc uint16, fn int) int {
+	l := location{pc, fn}
+	i, ok := p.locIndex[l]
+	if !ok {
+		i = len(p.locations)
+		p.locations = append(p.locations, l)
+		p.locIndex[l] = i
+	}
+	return i
+}
+
+// push enters a function.
+func (p *Profiler) push(entry uint16, kind Kind, call uint16) {
+	if len(p.stack) == maxDepth {
+		return
+	}
+	fn := p.function(entry, kind)
+	p.calls[fn]++
+	k := ctxKey{parent: -1, fn: fn, call: call}
+	if len(p.stack) > 0 && kind != IRQ && kind != NMI {
+		k.parent = p.stack[len(p.stack)-1].ctx
+	}
+	ctx, ok := p.contexts[k]
+	if !ok {
+		ctx = len(p.contexts)
+		p.contexts[k] = ctx
+	}
+	p.stack = append(p.stack, frame{fn: fn, call: call, ctx: ctx})
+}
+
+// pop leaves the innermost function if it is of one of the kinds, RTS does
+// not return from an interrupt handler.
+func (p *Profiler) pop(kinds ...Kind) {
+	if len(p.stack) == 0 {
+		return
+	}
+	top := p.functions[p.stack[len(p.stack)-1].fn].kind
+	for _, k := range kinds {
+		if top == k {
+			p.stack = p.stack[:len(p.stack)-1]
+			return
+		}
+	}
+}
+
+// sampleAt returns the sample for an instruction at pc on the current stack.
+func (p *Profiler) sampleAt(pc uint16) *sample {
+	if len(p.stack) == 0 {
+		p.push(pc, TopLevel, 0)
+	}
+	key := sampleKey{p.stack[len(p.stack)-1].ctx, pc}
+	if s, ok := p.samples[key]; ok {
+		return s
+	}
+	s := &sample{}
+	at := pc
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		f := p.stack[i]
+		s.locs = append(s.locs, p.location(at, f.fn))
+		if kind := p.functions[f.fn].kind; kind == IRQ || kind == NMI {
+			break // the handler's stack ends here
+		}
+		at = f.call
+	}
+	p.samples[key] = s
+	return s
+}
+
+// charge counts the cycles since the last instruction started, or carries
+// those of an interrupt sequence over to the handler.
+func (p *Profiler) charge() {
+	now := p.m.Clock().Cycles()
+	d := now - p.lastCyc
+	switch {
+	case p.last != nil:
+		p.last.cycles += d
+		p.perPC[p.lastPC] += d
+	case p.pending != TopLevel:
+		p.carried += d
+	}
+	p.lastCyc = now
+}
+
+// enter updates the call stack for the code at pc: first the call or return
+// of the instruction run last, then the interrupt taken since.
+func (p *Profiler) enter(pc uint16) {
+	if p.ran {
+		switch p.lastOp {
+		case opJSR:
+			p.push(pc, Subroutine, p.lastPC)
+		case opBRK:
+			p.push(pc, IRQ, 0)
+		case opRTS:
+			p.pop(Subroutine, TopLevel)
+		case opRTI:
+			p.pop(IRQ, NMI)
+		}
+		p.ran = false
+	}
+	if p.pending != TopLevel {
+		p.push(pc, p.pending, 0)
+		p.pending = TopLevel
+	}
+}
+
+// Instruction implements cpu.Tracer.
+func (p *Profiler) Instruction(c *cpu.CPU) {
+	p.charge()
+	pc := c.State().PC
+	p.enter(pc)
+	p.ran = true
+	p.lastOp = p.m.Memory().Peek(pc)
+	p.lastPC = pc
+	p.last = p.sampleAt(pc)
+	p.last.count++
+	p.last.cycles += p.carried
+	p.perPC[pc] += p.carried
+	p.carried = 0
+}
+
+// Interrupt implements cpu.Tracer, the interrupt sequence counts for the
+// first instruction of the handler.
+func (p *Profiler) Interrupt(c *cpu.CPU, nmi bool) {
+	p.charge()
+	p.enter(c.State().PC)
+	p.last = nil
+	p.pending = IRQ
+	if nmi {
+		p.pending = NMI
+	}
+}
+
+// Halt implements cpu.Tracer.
+func (p *Profiler) Halt(c *cpu.CPU, err error) {
+	p.charge()
+	p.last = nil
+}
+
+// Cycles returns the cycles spent in the instructions at pc.
+func (p *Profiler) Cycles(pc uint16) uint64 {
+	return p.perPC[pc]
+}
+
+// Total returns the cycles profiled.
+func (p *Profiler) Total() uint64 {
+	var total uint64
+	for _, c := range p.perPC {
+		total += c
+	}
+	return total
+}
+
+// Function is the profile of one function.
+type Function struct {
+	Entry uint16
+	Name  string
+	Kind  Kind
+	Calls uint64
+	// Exclusive cycles are spent in the function itself, Inclusive ones
+	// include the subroutines it called.
+	Exclusive, Inclusive uint64
+}
+
+func (p *Profiler) name(f function) string {
+	name, ok := p.Symbols[f.entry]
+	if !ok {
+		name = fmt.Sprintf("$%04x", f.entry)
+	}
+	switch f.kind {
+	case IRQ:
+		return "IRQ " + name
+	case NMI:
+		return "NMI " + name
+	}
+	return name
+}
+
+// Functions returns the functions by inclusive cycles, most first.
+func (p *Profiler) Functions() []Function {
+	fns := make([]Function, len(p.functions))
+	for i, f := range p.functions {
+		fns[i] = Function{Entry: f.entry, Name: p.name(f), Kind: f.kind, Calls: p.calls[i]}
+	}
+	for _, s := range p.samples {
+		seen := map[int]bool{}
+		for i, loc := range s.locs {
+			fn := p.locations[loc].fn
+			if i == 0 {
+				fns[fn].Exclusive += s.cycles
+			}
+			if !seen[fn] {
+				fns[fn].Inclusive += s.cycles
+				seen[fn] = true
+			}
+		}
+	}
+	sort.Slice(fns, func(i, j int) bool {
+		if fns[i].Inclusive != fns[j].Inclusive {
+			return fns[i].Inclusive > fns[j].Inclusive
+		}
+		return fns[i].Entry < fns[j].Entry
+	})
+	return fns
+}
@@ -0,0 +1,212 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/asm"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+)
+
+// profileProgram runs src from $c000 with interrupts disabled for the given
+// number of instructions.
+func profileProgram(t *testing.T, src string, n int) (*Profiler, *asm.Program) {
+	m, prog := machinetest.Load(t, src)
+	p := New(m)
+	p.Symbols = disasm.Symbols{}
+	for name, addr := range prog.Labels {
+		p.Symbols[addr] = name
+	}
+	m.SetTracer(p)
+	for i := 0; i < n; i++ {
+		m.StepInstruction()
+	}
+	return p, prog
+}
+
+func TestProfile(t *testing.T) {
+	p, prog := profileProgram(t, `
+main:	ldx #10
+loop:	jsr outer
+		dex
+		bne loop
+done:	jmp done
+outer:	jsr inner   ; 6
+		nop         ; 2
+		rts         ; 6
+inner:	lda #1      ; 2
+		rts         ; 6`, 1+10*8+1)
+
+	fns := map[string]Function{}
+	for _, f := range p.Functions() {
+		fns[f.Name] = f
+	}
+	inner, outer, main := fns["inner"], fns["outer"], fns["main"]
+	if inner.Calls != 10 || inner.Exclusive != 80 || inner.Inclusive != 80 {
+		t.Errorf("inner %+v", inner)
+	}
+	if outer.Calls != 10 || outer.Exclusive != 140 || outer.Inclusive != 220 {
+		t.Errorf("outer %+v", outer)
+	}
+	// ldx, 10 times jsr dex bne, the last bne not taken
+	if main.Kind != TopLevel || main.Exclusive != 2+10*(6+2+3)-1 || main.Inclusive != main.Exclusive+220 {
+		t.Errorf("main %+v", main)
+	}
+	if got := p.Cycles(prog.Labels["inner"]); got != 20 {
+		t.Errorf("cycles at inner = %d, want 20", got)
+	}
+	if p.Total() != main.Inclusive {
+		t.Errorf("total %d, want %d", p.Total(), main.Inclusive)
+	}
+}
+
+// TestProfileIRQ runs a CIA1 timer interrupt every 100 cycles, the
+// interrupt sequences count too.
+func TestProfileIRQ(t *testing.T) {
+	p, _ := profileProgram(t, `
+main:	lda #<irq
+		sta $0314
+		lda #>irq
+		sta $0315
+		lda #100
+		sta $dc04
+		lda #0
+		sta $dc05
+		lda #$81
+		sta $dc0d
+		lda #$11
+		sta $dc0e
+		cli
+loop:	inx
+		jmp loop
+irq:	lda $dc0d   ; the KERNAL pushed A, X and Y
+		pla
+		tay
+		pla
+		tax
+		pla
+		rti`, 1)
+	start := p.m.Cycles() - 2 // the first lda
+	for i := 0; i < 5000; i++ {
+		p.m.StepInstruction()
+	}
+	p.Instruction(p.m.CPU()) // charge the last instruction
+	if want := p.m.Cycles() - start; p.Total() != want {
+		t.Errorf("total %d cycles, want %d", p.Total(), want)
+	}
+	var irqs uint64
+	for _, f := range p.Functions() {
+		if f.Kind == IRQ {
+			irqs += f.Calls
+		}
+	}
+	if irqs < 10 {
+		t.Errorf("%d interrupts profiled", irqs)
+	}
+}
+
+// TestProfileIRQAfterCall takes interrupts right after a JSR, an RTS and an
+// RTI: CLI lets the asserted IRQ in after the next instruction, the handler
+// acknowledges it every second time so it comes back right after the RTI.
+func TestProfileIRQAfterCall(t *testing.T) {
+	p, _ := profileProgram(t, `
+main:	lda #$2f
+		sta $00
+		lda #$35    ; no KERNAL, the vector in RAM
+		sta $01
+		lda #<irq
+		sta $fffe
+		lda #>irq
+		sta $ffff
+		lda #$81
+		sta $dc0d
+		jsr raise
+		cli
+		jsr sub     ; interrupted right after
+done:	jmp done
+sub:	sei
+		jsr raise
+		cli
+		rts         ; interrupted right after
+raise:	lda #8      ; a timer A underflow
+		sta $dc04
+		lda #0
+		sta $dc05
+		lda #$11
+		sta $dc0e
+		nop
+		nop
+		nop
+		nop
+		nop
+		nop
+		rts
+irq:	inc $02
+		lda $02
+		and #1
+		bne out
+		lda #0      ; stop the timer, then acknowledge
+		sta $dc0e
+		lda $dc0d
+out:	rti`, 200)
+	fns := map[string]Function{}
+	for _, f := range p.Functions() {
+		fns[f.Name] = f
+	}
+	sub, irq, raise := fns["sub"], fns["IRQ irq"], fns["raise"]
+	if sub.Calls != 1 || raise.Calls != 2 || irq.Calls != 4 {
+		t.Errorf("calls: sub %d, raise %d, irq %d, want 1, 2, 4", sub.Calls, raise.Calls, irq.Calls)
+	}
+	// 7 for the sequence, inc lda and, then bne out rti or the acknowledge
+	if want := uint64(2 * (7 + 5 + 3 + 2 + 3 + 6 + 7 + 5 + 3 + 2 + 2 + 2 + 4 + 4 + 6)); irq.Inclusive != want {
+		t.Errorf("irq inclusive %d cycles, want %d", irq.Inclusive, want)
+	}
+	// sei, cli and rts around raise
+	if want := 2 + 6 + raise.Inclusive/2 + 2 + 6; sub.Inclusive != want {
+		t.Errorf("sub inclusive %d cycles, want %d", sub.Inclusive, want)
+	}
+}
+
+func TestPprof(t *testing.T) {
+	p, _ := profileProgram(t, `
+loop:	jsr sub
+		jmp loop
+sub:	rts`, 100)
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// field 1, length delimited, holding the cycles sample type
+	if len(data) < 2 || data[0] != 1<<3|wireLengthDelimited {
+		t.Fatalf("profile starts with % x", data[:min(len(data), 8)])
+	}
+	for _, s := range []string{"cycles", "instructions", "loop", "sub"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("no %q in the profile", s)
+		}
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, tc := range []struct {
+		v    uint64
+		want []byte
+	}{{0, []byte{0}}, {1, []byte{1}}, {300, []byte{0xac, 0x02}}, {0x10000, []byte{0x80, 0x80, 0x04}}} {
+		var m message
+		m.varint(tc.v)
+		if !bytes.Equal(m, tc.want) {
+			t.Errorf("%d: % x, want % x", tc.v, []byte(m), tc.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package trace writes the instructions a machine runs, with registers,
+// cycle count and raster position. Tracing can start and stop on conditions
+// such as a PC range or a cycle window, and the last instructions are kept
+// in a history that is dumped when the CPU jams.
+//
+//	t := trace.New(m, f, 1000)
+//	t.Start = trace.PCRange(0xc000, 0xc0ff)
+//	t.Crash = os.Stderr
+//	m.SetTracer(t)
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/disasm"
+	"github.com/jejer/commando64/pkg/c64/machine"
+)
+
+// Entry is one traced instruction, with the registers before it ran.
+type Entry struct {
+	PC          uint16
+	Code        [3]uint8 // the opcode and the two bytes after it
+	A, X, Y, P  uint8
+	SP          uint8
+	Cycle       uint64
+	RasterLine  uint16
+	RasterCycle int
+
+	// Instr is the disassembly, it is filled in when the entry is written,
+	// conditions see it empty.
+	Instr disasm.Line
+}
+
+// Flags returns the status register as NV-BDIZC, clear flags as dots.
+func (e *Entry) Flags() string {
+	b := []byte("NV-BDIZC")
+	for i := range b {
+		if e.P&(0x80>>i) == 0 && b[i] != '-' {
+			b[i] = '.'
+		}
+	}
+	return string(b)
+}
+
+// Condition decides on an instruction whether tracing starts, stops or
+// writes it.
+type Condition func(e *Entry) bool
+
+// PCRange matches the instructions from addresses from to to, inclusive.
+func PCRange(from, to uint16) Condition {
+	return func(e *Entry) bool { return e.PC >= from && e.PC <= to }
+}
+
+// CycleWindow matches the instructions starting from cycle from up to, not
+// including, cycle to.
+func CycleWindow(from, to uint64) Condition {
+	return func(e *Entry) bool { return e.Cycle >= from && e.Cycle < to }
+}
+
+// ParseRange parses "from-to" or a single number, in hex with a $ or 0x
+// prefix, else decimal. A single number is a range of one.
+func ParseRange(s string) (from, to uint64, err error) {
+	a, b, ok := strings.Cut(s, "-")
+	if from, err = parseNumber(a); err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return from, from, nil
+	}
+	if to, err = parseNumber(b); err == nil && to < from {
+		err = fmt.Errorf("trace: range %s ends before it starts", s)
+	}
+	return from, to, err
+}
+
+func parseNumber(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	base := 10
+	if strings.HasPrefix(s, "$") {
+		s, base = s[1:], 16
+	} else if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	v, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("trace: bad number %q", s)
+	}
+	return v, nil
+}
+
+// VICE is the default format, the layout of the VICE monitor's chis
+// command with the raster line and cycle before the cycle count.
+const VICE = `.C:{{printf "%04X" .PC}}  {{.Instr.Bytes | hex | printf "%-10s"}}  {{.Instr.Text | upper | printf "%-14s"}} - ` +
+	`A:{{printf "%02X" .A}} X:{{printf "%02X" .X}} Y:{{printf "%02X" .Y}} SP:{{printf "%02x" .SP}} {{.Flags}} ` +
+	`{{printf "%03d %03d %10d" .RasterLine .RasterCycle .Cycle}}`
+
+// Funcs are the functions templates can use besides the builtin ones.
+var Funcs = template.FuncMap{
+	"hex": func(b []uint8) string {
+		s := make([]string, len(b))
+		for i, v := range b {
+			s[i] = fmt.Sprintf("%02X", v)
+		}
+		return strings.Join(s, " ")
+	},
+	"upper": strings.ToUpper,
+}
+
+// Parse parses a format for Tracer.Format, one line per instruction. The
+// template runs on an *Entry.
+func Parse(format string) (*template.Template, error) {
+	return template.New("trace").Funcs(Funcs).Parse(format)
+}
+
+var viceFormat = template.Must(Parse(VICE))
+
+// Tracer is a cpu.Tracer for a machine. Set the fields before it is
+// attached.
+type Tracer struct {
+	// Start turns tracing on at the first instruction it matches, nil
+	// traces from the start. After Stop it is checked again.
+	Start Condition
+	// Stop turns tracing off at the first instruction it matches, that
+	// instruction is not written. nil traces until the tracer is removed.
+	Stop Condition
+	// Filter selects the instructions written while tracing is on, nil
+	// writes all.
+	Filter Condition
+	// Format is the line format, nil for VICE.
+	Format  *template.Template
+	Symbols disasm.Symbols
+	// Crash receives the history when the CPU jams, if set.
+	Crash io.Writer
+
+	m       *machine.Machine
+	out     *bufio.Writer
+	on      bool
+	started bool
+	history []Entry
+	next    int // next slot of history
+	full    bool
+	err     error
+}
+
+// New returns a tracer of m writing to out, out may be nil to only keep a
+// history of the last n instructions.
+func New(m *machine.Machine, out io.Writer, n int) *Tracer {
+	t := &Tracer{m: m, history: make([]Entry, n)}
+	if out != nil {
+		t.out = bufio.NewWriter(out)
+	}
+	return t
+}
+
+// Instruction implements cpu.Tracer.
+func (t *Tracer) Instruction(c *cpu.CPU) {
+	s := c.State()
+	mem := t.m.Memory()
+	e := Entry{
+		PC:    s.PC,
+		Code:  [3]uint8{mem.Peek(s.PC), mem.Peek(s.PC + 1), mem.Peek(s.PC + 2)},
+		A:     s.A,
+		X:     s.X,
+		Y:     s.Y,
+		P:     s.P,
+		SP:    s.SP,
+		Cycle: t.m.Clock().Cycles(),
+	}
+	e.RasterLine, e.RasterCycle = t.m.VIC().Raster()
+	if len(t.history) > 0 {
+		t.history[t.next] = e
+		t.next = (t.next + 1) % len(t.history)
+		t.full = t.full || t.next == 0
+	}
+
+	if t.on {
+		t.on = t.Stop == nil || !t.Stop(&e)
+	} else {
+		t.on = t.Start == nil && !t.started || t.Start != nil && t.Start(&e)
+		t.started = true
+	}
+	if t.on && t.out != nil && t.err == nil && (t.Filter == nil || t.Filter(&e)) {
+		t.err = t.write(t.out, &e)
+	}
+}
+
+// Interrupt implements cpu.Tracer, the trace shows the handler's
+// instructions.
+func (t *Tracer) Interrupt(c *cpu.CPU, nmi bool) {}
+
+// Halt implements cpu.Tracer, it writes the history to Crash.
+func (t *Tracer) Halt(c *cpu.CPU, err error) {
+	t.Flush()
+	if t.Crash == nil {
+		return
+	}
+	fmt.Fprintf(t.Crash, "%v\nlast %d instructions:\n", err, len(t.History()))
+	t.Dump(t.Crash)
+}
+
+// History returns the last instructions run, oldest first.
+func (t *Tracer) History() []Entry {
+	if !t.full {
+		return append([]Entry(nil), t.history[:t.next]...)
+	}
+	return append(append([]Entry(nil), t.history[t.next:]...), t.history[:t.next]...)
+}
+
+// Dump writes the history in the trace format.
+func (t *Tracer) Dump(w io.Writer) error {
+	for _, e := range t.History() {
+		if err := t.write(w, &e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracer) write(w io.Writer, e *Entry) error {
+	code := e.Code
+	e.Instr = disasm.Disassemble(func(addr uint16) uint8 { return code[(addr-e.PC)%3] }, e.PC, t.Symbols)
+	format := t.Format
+	if format == nil {
+		format = viceFormat
+	}
+	if err := format.Execute(w, e); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Flush writes out the buffered trace and returns the first write error.
+func (t *Tracer) Flush() error {
+	if t.out != nil && t.err == nil {
+		t.err = t.out.Flush()
+	}
+	return t.err
+}
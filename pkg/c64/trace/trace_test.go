@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jejer/commando64/pkg/c64/cpu"
+	"github.com/jejer/commando64/pkg/c64/internal/machinetest"
+)
+
+func TestTracer(t *testing.T) {
+	m, _ := machinetest.Load(t, `
+		ldx #2
+loop:	dex
+		bne loop
+		sta $d020
+		.byte $02`)
+	var out, crash strings.Builder
+	tr := New(m, &out, 3)
+	tr.Start = PCRange(0xc002, 0xc002)
+	tr.Stop = PCRange(0xc005, 0xc007)
+	tr.Crash = &crash
+	m.SetTracer(tr)
+	for i := 0; i < 10 && m.CPU().Err() == nil; i++ {
+		m.StepInstruction()
+	}
+	var jam *cpu.JamError
+	if !errors.As(m.CPU().Err(), &jam) {
+		t.Fatalf("err = %v, want a jam", m.CPU().Err())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		".C:C002  CA          DEX            - A:",
+		".C:C003  D0 FD       BNE $C002      - A:",
+		".C:C002  CA          DEX            - A:",
+		".C:C003  D0 FD       BNE $C002      - A:",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("trace:\n%s", out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d: %q, want %q...", i, lines[i], w)
+		}
+	}
+	if !strings.Contains(lines[1], "X:01") || !strings.Contains(lines[3], "..-..IZ.") {
+		t.Errorf("registers:\n%s", out.String())
+	}
+
+	h := tr.History()
+	if len(h) != 3 || h[0].PC != 0xc003 || h[2].PC != 0xc008 {
+		t.Errorf("history %+v", h)
+	}
+	if !strings.Contains(crash.String(), "JAM $02 at $c008") || !strings.Contains(crash.String(), "STA $D020") {
+		t.Errorf("crash dump:\n%s", crash.String())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	m, _ := machinetest.Load(t, "lda #$41\nnop")
+	format, err := Parse(`{{printf "%04x" .PC}} {{.Instr.Text}} a={{.A}} cycle={{.Cycle}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	tr := New(m, &out, 0)
+	tr.Format = format
+	tr.Filter = CycleWindow(m.Cycles()+1, m.Cycles()+4)
+	m.SetTracer(tr)
+	m.StepInstruction()
+	m.StepInstruction()
+	m.StepInstruction()
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "c002 NOP a=65 cycle="
+	if !strings.HasPrefix(out.String(), want) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("got %q, want %q...", out.String(), want)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		from, to uint64
+	}{{"$c000-$c0ff", 0xc000, 0xc0ff}, {"0xe5d4", 0xe5d4, 0xe5d4}, {"1000-2000", 1000, 2000}} {
+		from, to, err := ParseRange(tc.s)
+		if err != nil || from != tc.from || to != tc.to {
+			t.Errorf("%s: %x-%x %v", tc.s, from, to, err)
+		}
+	}
+	if _, _, err := ParseRange("$20-$10"); err == nil {
+		t.Error("reversed range accepted")
+	}
+}
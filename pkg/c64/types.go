@@ -10,6 +10,7 @@ type MemoryBus interface {
 	ReadWord(addr uint16) uint16
 	ReadRom(addr uint16) uint8
 	VicRead(addr uint16) uint8
+	VicColorRead(addr uint16) uint8
 }
 
 type PeripheralIO interface {
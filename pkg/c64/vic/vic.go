@@ -7,6 +7,7 @@ import (
 
 	"github.com/jejer/commando64/pkg/c64"
 	"github.com/jejer/commando64/pkg/c64/clock"
+	"github.com/jejer/commando64/pkg/c64/irq"
 )
 
 // VIC-II
@@ -26,22 +27,10 @@ const (
 	ExtBGColorMode                          // ECM1 BMM0 MCM0
 	InvalidMode
 
-	// screen constants
-	// https://dustlayer.com/vic-ii/2013/4/25/vic-ii-for-beginners-beyond-the-screen-rasters-cycle
-	ScreenLines            = 312
-	ScreenWidth            = 504
-	ScreenVisibleLines     = 284
-	ScreenVisibleWidth     = 403
-	ScreenFirstVisibleLine = 14 // start from 0
-	ScreenLastVisibleLine  = 298
-	ScreenFirstTextLine    = 56
-	ScreenLastTextLine     = 256
-	ScreenFirstTextCol     = 42
-	ScreenTextLines        = 200
-	ScreenTextWidth        = 320
-	ScreenTextPerLine      = 40
-	LineCycles             = 63
-	BadLineCycles          = 23
+	// BA is low on a bad line from 3 cycles before the character pointer
+	// fetches until their end, the CPU halts on its first read in between
+	BadLineBAFirst = 12
+	BadLineBALast  = 54
 
 	ColorRamStartPage uint16 = 0xd800
 )
@@ -49,10 +38,11 @@ const (
 type VICII struct {
 	logger       slog.Logger
 	clock        *clock.Clock
-	cycle        int8
-	cpuCycle     int8
+	model        c64.Model
+	cycle        int8 // cycle in the current raster line, starting from 1
+	badLine      bool // the current raster line is a bad line
 	mem          c64.MemoryBus
-	irqCh        chan<- bool
+	irq          *irq.Controller
 	peripheralIO c64.PeripheralIO
 
 	// https://www.c64-wiki.com/wiki/Page_208-211
@@ -109,14 +99,101 @@ type VICII struct {
 	lastFrameTime time.Time
 }
 
-func NewVICII(logger slog.Logger, clock *clock.Clock, m c64.MemoryBus, ch chan<- bool, io c64.PeripheralIO) *VICII {
-	vic := &VICII{mem: m, peripheralIO: io, irqCh: ch, clock: clock}
+// State is the VIC state captured in machine snapshots,
+// the graphic mode and memory offsets are derived from the registers.
+type State struct {
+	SpritePos             [16]uint8
+	SpriteMSBx            uint8
+	Control1              uint8
+	RasterPos             uint8
+	LightpenPos           [2]uint8
+	SpriteEnabled         uint8
+	Control2              uint8
+	SpriteExpY            uint8
+	MemPointers           uint8
+	InterruptStatus       uint8
+	InterruptEnabled      uint8
+	SpriteDataPriority    uint8
+	SpriteMulticolor      uint8
+	SpriteExpX            uint8
+	SpriteSpriteCollision uint8
+	SpriteDataCollision   uint8
+	ColorBorder           uint8
+	ColorBackground       [4]uint8
+	ColorSpriteMulti      [2]uint8
+	ColorSprite           [8]uint8
+	RasterIrqRequest      uint16
+	Cycle                 int8
+	BadLine               bool
+	Frame                 int64
+}
+
+func NewVICII(logger slog.Logger, clock *clock.Clock, model c64.Model, m c64.MemoryBus, irq *irq.Controller, io c64.PeripheralIO) *VICII {
+	vic := &VICII{mem: m, peripheralIO: io, irq: irq, clock: clock, model: model}
 	vic.logger = *logger.With("Component", "VICII")
 	vic.cycle = 1
-	vic.cpuCycle = 1
 	return vic
 }
 
+func (vic *VICII) State() State {
+	return State{
+		SpritePos:             vic.spritePos,
+		SpriteMSBx:            vic.spriteMSBx,
+		Control1:              vic.control1,
+		RasterPos:             vic.rasterPos,
+		LightpenPos:           vic.lightpenPos,
+		SpriteEnabled:         vic.spriteEnabled,
+		Control2:              vic.control2,
+		SpriteExpY:            vic.spriteExpY,
+		MemPointers:           vic.memPointers,
+		InterruptStatus:       vic.interruptStatus,
+		InterruptEnabled:      vic.interruptEnabled,
+		SpriteDataPriority:    vic.spriteDataPriority,
+		SpriteMulticolor:      vic.spriteMulticolor,
+		SpriteExpX:            vic.spriteExpX,
+		SpriteSpriteCollision: vic.spriteSpriteCollision,
+		SpriteDataCollision:   vic.spriteDataCollision,
+		ColorBorder:           vic.colorBorder,
+		ColorBackground:       vic.colorBackground,
+		ColorSpriteMulti:      vic.colorSpriteMulti,
+		ColorSprite:           vic.colorSprite,
+		RasterIrqRequest:      vic.rasterIrqRequest,
+		Cycle:                 vic.cycle,
+		BadLine:               vic.badLine,
+		Frame:                 int64(vic.frame),
+	}
+}
+
+func (vic *VICII) SetState(s State) {
+	vic.spritePos = s.SpritePos
+	vic.spriteMSBx = s.SpriteMSBx
+	vic.control1 = s.Control1
+	vic.rasterPos = s.RasterPos
+	vic.lightpenPos = s.LightpenPos
+	vic.spriteEnabled = s.SpriteEnabled
+	vic.control2 = s.Control2
+	vic.spriteExpY = s.SpriteExpY
+	vic.Write(0xd018, s.MemPointers)
+	vic.interruptStatus = s.InterruptStatus
+	vic.interruptEnabled = s.InterruptEnabled
+	vic.updateIRQ()
+	vic.spriteDataPriority = s.SpriteDataPriority
+	vic.spriteMulticolor = s.SpriteMulticolor
+	vic.spriteExpX = s.SpriteExpX
+	vic.spriteSpriteCollision = s.SpriteSpriteCollision
+	vic.spriteDataCollision = s.SpriteDataCollision
+	vic.colorBorder = s.ColorBorder
+	vic.colorBackground = s.ColorBackground
+	vic.colorSpriteMulti = s.ColorSpriteMulti
+	vic.colorSprite = s.ColorSprite
+	vic.rasterIrqRequest = s.RasterIrqRequest
+	vic.cycle = s.Cycle
+	vic.badLine = s.BadLine
+	vic.frame = int(s.Frame)
+	vic.lastFrame = vic.frame
+	vic.setGraphicMode()
+}
+
 func (vic *VICII) Write(addr uint16, v uint8) {
 	switch add := addr & 0x00ff; {
 	case add >= 0x00 && add <= 0x0f:
@@ -152,8 +229,10 @@ func (vic *VICII) Write(addr uint16, v uint8) {
 		vic.bitmapMemOffset = (uint16(v) & 0x08) << 10
 	case add == 0x19: // irq acknowledge
 		vic.interruptStatus &= ^(v & 0x0f)
+		vic.updateIRQ()
 	case add == 0x1a:
 		vic.interruptEnabled = v
+		vic.updateIRQ()
 	case add == 0x1b:
 		vic.spriteDataPriority = v
 	case add == 0x1c:
@@ -197,7 +276,7 @@ func (vic *VICII) Read(addr uint16) uint8 {
 		return vic.memPointers
 	case add == 0x19: // irq status
 		v := vic.interruptStatus & 0x0f
-		if v != 0 {
+		if v&vic.interruptEnabled != 0 {
 			v |= 0x80 // IRQ bit
 		}
 		v |= 0x70 // non-connected bits (always set)
@@ -225,44 +304,50 @@ func (vic *VICII) Read(addr uint16) uint8 {
 	return 0
 }
 
-func (vic *VICII) Run() {
-	d := time.Duration(time.Second) / (50 * ScreenLines)
-	t := time.NewTicker(d)
-	for range t.C {
-		now := time.Now()
-		isBadLine := vic.step()
-		if isBadLine {
-			vic.clock.CPU <- BadLineCycles
-		} else {
-			vic.clock.CPU <- LineCycles
-		}
-		if now.After(vic.lastFrameTime.Add(time.Duration(time.Second * 10))) {
-			vic.logger.Info("FPS", "FPS", (vic.frame-vic.lastFrame)/10)
-			vic.lastFrame = vic.frame
-			vic.lastFrameTime = now
-		}
+// Tick advances the VIC by one cycle. The whole raster line is drawn on its
+// first cycle, on bad lines RDY is held low while the character fetches
+// take the bus.
+func (vic *VICII) Tick() {
+	if vic.cycle == 1 {
+		vic.badLine = vic.step()
+	}
+	vic.clock.SetRDY(!vic.badLine || vic.cycle < BadLineBAFirst || vic.cycle > BadLineBALast)
+	vic.cycle++
+	if int(vic.cycle) > vic.model.LineCycles {
+		vic.cycle = 1
 	}
 }
 
-// a step is a raster line
-func (vic *VICII) step() bool {
-	if vic.interruptStatus&0x80 != 0 {
-		// interrupts are not handled by CPU
-		go func() { vic.irqCh <- false }()
+// Frame returns the number of frames completed so far.
+func (vic *VICII) Frame() int {
+	return vic.frame
+}
+
+// Raster returns the raster line and the cycle within it the VIC runs next.
+func (vic *VICII) Raster() (line uint16, cycle int) {
+	// the raster counter moves on at the first cycle of a line
+	line = uint16(vic.rasterPos) | uint16(vic.control1&0x80)<<1
+	if vic.cycle != 1 {
+		line = (line + uint16(vic.model.Lines) - 1) % uint16(vic.model.Lines)
 	}
+	return line, int(vic.cycle)
+}
 
+// a step is a raster line
+func (vic *VICII) step() bool {
 	var line uint16 = uint16(vic.rasterPos) | (uint16(vic.control1&0x0080) << 1)
 
-	if vic.interruptEnabled&0x01 != 0 && line == vic.rasterIrqRequest {
-		// check and trigger raster line irq
+	if line == vic.rasterIrqRequest {
+		// the raster match is latched even when the irq is masked,
+		// the KERNAL relies on it to tell PAL from NTSC
 		vic.interruptStatus |= 0x01
-		go func() { vic.irqCh <- false }()
+		vic.updateIRQ()
 	}
 
 	// draw line
-	if line >= ScreenFirstVisibleLine && line < ScreenLastVisibleLine {
-		y := line - ScreenFirstVisibleLine
-		for x := 0; x < ScreenVisibleWidth; x++ {
+	if int(line) >= vic.model.FirstVisibleLine && int(line) < vic.model.LastVisibleLine {
+		y := line - uint16(vic.model.FirstVisibleLine)
+		for x := 0; x < c64.ScreenVisibleWidth; x++ {
 			vic.peripheralIO.SetFramePixel(x, y, vic.colorBorder)
 		}
 		switch vic.mode {
@@ -285,11 +370,16 @@ func (vic *VICII) step() bool {
 	// update raster
 	// vic.logger.Info("raster line", "line", line)
 	line++
-	if line == ScreenLines {
+	if int(line) == vic.model.Lines {
 		line = 0
 		vic.peripheralIO.RefreshScreen()
 		// vic.logger.Info("frame", "frame", vic.frame)
 		vic.frame++
+		if now := time.Now(); now.After(vic.lastFrameTime.Add(time.Duration(time.Second * 10))) {
+			vic.logger.Info("FPS", "FPS", (vic.frame-vic.lastFrame)/10)
+			vic.lastFrame = vic.frame
+			vic.lastFrameTime = now
+		}
 	}
 	vic.rasterPos = uint8(line & 0x00ff)
 	vic.control1 &= 0x7f
@@ -298,6 +388,12 @@ func (vic *VICII) step() bool {
 	return isBadLine
 }
 
+// updateIRQ holds the IRQ line while an enabled interrupt is latched,
+// until the program acknowledges it through $d019.
+func (vic *VICII) updateIRQ() {
+	vic.irq.SetIRQ(irq.SourceVIC, vic.interruptStatus&vic.interruptEnabled&0x0f != 0)
+}
+
 func (vic *VICII) setGraphicMode() {
 	mode := (vic.control1 & 0x60) >> 4 // get ICM and BMM bit
 	mode |= (vic.control2 & 0x10) >> 4 // get MCM bit
@@ -309,24 +405,24 @@ func (vic *VICII) setGraphicMode() {
 }
 
 func (vic *VICII) drawCharRasterLine(line, y uint16) {
-	if line < ScreenFirstTextLine || line >= ScreenLastTextLine || (vic.control1<<4) == 0 {
+	if line < c64.ScreenFirstTextLine || line >= c64.ScreenLastTextLine || (vic.control1<<4) == 0 {
 		return
 	}
 
 	// text background
-	for x := 0; x < ScreenTextWidth; x++ {
-		vic.peripheralIO.SetFramePixel(x+ScreenFirstTextCol, y, vic.colorBackground[0])
+	for x := 0; x < c64.ScreenTextWidth; x++ {
+		vic.peripheralIO.SetFramePixel(x+c64.ScreenFirstTextCol, y, vic.colorBackground[0])
 	}
 
 	// text dots in this line
-	for col := 0; col < ScreenTextPerLine; col++ {
-		row := (line - ScreenFirstTextLine) / 8
+	for col := 0; col < c64.ScreenTextPerLine; col++ {
+		row := (line - c64.ScreenFirstTextLine) / 8
 		char := vic.getScreenChar(row, uint16(col))
 		color := vic.getCharColor(row, uint16(col))
-		data := vic.getCharData(char, (line-ScreenFirstTextLine)%8)
+		data := vic.getCharData(char, (line-c64.ScreenFirstTextLine)%8)
 		for i := 0; i < 8; i++ {
 			if data&(1<<i) != 0 {
-				x := ScreenFirstTextCol + (col * 8) + 8 - i
+				x := c64.ScreenFirstTextCol + (col * 8) + 8 - i
 				vic.peripheralIO.SetFramePixel(x, y, color)
 			}
 		}
@@ -334,7 +430,7 @@ func (vic *VICII) drawCharRasterLine(line, y uint16) {
 }
 
 func (vic *VICII) getScreenChar(row, col uint16) uint8 {
-	addr := vic.screenMemOffset + row*ScreenTextPerLine + col
+	addr := vic.screenMemOffset + row*c64.ScreenTextPerLine + col
 	return vic.mem.VicRead(addr)
 }
 
@@ -344,8 +440,8 @@ func (vic *VICII) getCharData(char uint8, row uint16) uint8 {
 }
 
 func (vic *VICII) getCharColor(row, col uint16) uint8 {
-	addr := ColorRamStartPage + row*ScreenTextPerLine + col
-	return vic.mem.Read(addr)
+	addr := ColorRamStartPage + row*c64.ScreenTextPerLine + col
+	return vic.mem.VicColorRead(addr)
 }
 
 // According to Christian Bauer's paper: